@@ -0,0 +1,114 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ACMETLS1Protocol is the ALPN protocol of ACME tls-alpn-01 challenges, see
+// RFC 8737.
+const ACMETLS1Protocol = "acme-tls/1"
+
+// SetChallengeCertificate installs cert, as generated by an ACME client for a
+// tls-alpn-01 challenge, to be served for domain to clients offering only
+// ACMETLS1Protocol, while the reloaded certificate keeps serving everything
+// else. A nil cert removes it, effective for the next handshake, which should
+// be done as soon as the challenge is finished. Challenges for several
+// domains may be pending at once. It takes precedence over a certificate
+// registered by SetALPNCertificate for ACMETLS1Protocol.
+func (r *Reloader) SetChallengeCertificate(domain string, cert *tls.Certificate) {
+	r.setChallenge(domain, cert)
+}
+
+// setChallenge installs or removes the challenge certificate of domain, and
+// reports whether there was one.
+func (r *Reloader) setChallenge(domain string, cert *tls.Certificate) (existed bool) {
+	domain = strings.ToLower(domain)
+	r.overrideMu.Lock()
+	defer r.overrideMu.Unlock()
+	old, _ := r.challenges.Load().(map[string]*tls.Certificate)
+	_, existed = old[domain]
+	certs := make(map[string]*tls.Certificate, len(old)+1)
+	for d, c := range old {
+		certs[d] = c
+	}
+	if cert != nil {
+		certs[domain] = cert
+	} else {
+		delete(certs, domain)
+	}
+	r.challenges.Store(certs)
+	return
+}
+
+// challengeCertificate returns the challenge certificate for chi, if any.
+func (r *Reloader) challengeCertificate(chi *tls.ClientHelloInfo) *tls.Certificate {
+	certs, _ := r.challenges.Load().(map[string]*tls.Certificate)
+	if len(certs) == 0 || chi == nil || len(chi.SupportedProtos) != 1 || chi.SupportedProtos[0] != ACMETLS1Protocol {
+		return nil
+	}
+	return certs[strings.ToLower(chi.ServerName)]
+}
+
+var errInvalidChallenge = errors.New("invalid challenge certificate")
+
+// ACMEState lets an external ACME client present tls-alpn-01 challenge
+// certificates through the listener served by a Reloader, instead of running
+// a listener of its own, so that the Reloader remains the single source of
+// truth for what is presented: GetCertificate and GetConfigForClient serve a
+// pending challenge certificate to clients offering only ACMETLS1Protocol,
+// and the reloaded certificate to everyone else. Its methods are safe for
+// concurrent use, by any number of ACME goroutines, with each other as well
+// as with reloads and handshakes; a change is effective for the next
+// handshake. Reloads never touch challenge certificates. When only
+// GetCertificate is used, ACMETLS1Protocol must be listed in NextProtos of
+// the tls.Config, which GetConfigForClient takes care of.
+type ACMEState struct {
+	r *Reloader
+}
+
+// ACMEState returns the state for presenting ACME challenges, see ACMEState.
+// It shares the challenges of SetChallengeCertificate.
+func (r *Reloader) ACMEState() *ACMEState {
+	return &ACMEState{r}
+}
+
+// Register presents cert for the tls-alpn-01 challenge of domain, replacing
+// any pending one for it. cert must have a private key; its Leaf is parsed if
+// absent, and it must not be modified afterwards.
+func (s *ACMEState) Register(domain string, cert *tls.Certificate) error {
+	if domain == "" || cert == nil || cert.PrivateKey == nil || len(cert.Certificate) == 0 {
+		return errInvalidChallenge
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		c := *cert
+		c.Leaf = leaf
+		cert = &c
+	}
+	s.r.setChallenge(domain, cert)
+	return nil
+}
+
+// Deregister stops presenting the challenge of domain once it is finished,
+// and reports whether one was pending.
+func (s *ACMEState) Deregister(domain string) bool {
+	return s.r.setChallenge(domain, nil)
+}
+
+// Pending returns the domains of pending challenges in lower case, sorted.
+func (s *ACMEState) Pending() []string {
+	certs, _ := s.r.challenges.Load().(map[string]*tls.Certificate)
+	domains := make([]string, 0, len(certs))
+	for d := range certs {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	return domains
+}
@@ -0,0 +1,47 @@
+package certreloader
+
+import (
+	"crypto/tls"
+)
+
+// SetALPNCertificate registers cert to be served instead of the reloaded one
+// to clients offering the ALPN protocol proto, e.g. a challenge certificate
+// for "acme-tls/1". A nil cert removes the registration, taking effect for
+// the next handshake. If a client offers several registered protocols, its
+// most preferred one wins; clients offering none are served as usual,
+// including the selection of NewFromBundle. When used as
+// tls.Config.GetCertificate, proto must also be listed in NextProtos of the
+// server, while GetConfigForClient takes care of it.
+func (r *Reloader) SetALPNCertificate(proto string, cert *tls.Certificate) {
+	r.overrideMu.Lock()
+	defer r.overrideMu.Unlock()
+	old, _ := r.alpnCerts.Load().(map[string]*tls.Certificate)
+	certs := make(map[string]*tls.Certificate, len(old)+1)
+	for p, c := range old {
+		certs[p] = c
+	}
+	if cert != nil {
+		certs[proto] = cert
+	} else {
+		delete(certs, proto)
+	}
+	r.alpnCerts.Store(certs)
+}
+
+// alpnCertificate returns the certificate registered for the most preferred
+// protocol offered by chi, or the challenge certificate for chi, if any.
+func (r *Reloader) alpnCertificate(chi *tls.ClientHelloInfo) (string, *tls.Certificate) {
+	if cert := r.challengeCertificate(chi); cert != nil {
+		return ACMETLS1Protocol, cert
+	}
+	certs, _ := r.alpnCerts.Load().(map[string]*tls.Certificate)
+	if len(certs) == 0 || chi == nil {
+		return "", nil
+	}
+	for _, proto := range chi.SupportedProtos {
+		if cert := certs[proto]; cert != nil {
+			return proto, cert
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,122 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestALPNCertificate(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	certPEM, keyPEM := newTestPair(t, "challenge.example")
+	challenge, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetALPNCertificate("acme-tls/1", &challenge)
+
+	for _, tt := range []struct {
+		protos []string
+		want   *tls.Certificate
+	}{
+		{nil, r.Get()},
+		{[]string{"h2", "http/1.1"}, r.Get()},
+		{[]string{"acme-tls/1"}, &challenge},
+	} {
+		chi := &tls.ClientHelloInfo{SupportedProtos: tt.protos}
+		if cert, err := r.GetCertificate(chi); err != nil || cert != tt.want {
+			t.Errorf("%v: got %p, %v, want %p", tt.protos, cert, err, tt.want)
+		}
+		config, err := r.GetConfigForClient(chi)
+		if err != nil || string(config.Certificates[0].Certificate[0]) != string(tt.want.Certificate[0]) {
+			t.Errorf("%v: config does not serve wanted certificate", tt.protos)
+		}
+	}
+
+	r.SetALPNCertificate("acme-tls/1", nil)
+	chi := &tls.ClientHelloInfo{SupportedProtos: []string{"acme-tls/1"}}
+	if cert, _ := r.GetCertificate(chi); cert != r.Get() {
+		t.Error("removed certificate is still served")
+	}
+}
+
+func TestChallengeCertificate(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	certPEM, keyPEM := newTestPair(t, "a.example")
+	challenge, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetChallengeCertificate("A.example", &challenge)
+
+	for _, tt := range []struct {
+		name   string
+		protos []string
+		want   *tls.Certificate
+	}{
+		{"a.example", []string{ACMETLS1Protocol}, &challenge},
+		{"b.example", []string{ACMETLS1Protocol}, r.Get()},
+		{"a.example", []string{"h2"}, r.Get()},
+	} {
+		chi := &tls.ClientHelloInfo{ServerName: tt.name, SupportedProtos: tt.protos}
+		if cert, err := r.GetCertificate(chi); err != nil || cert != tt.want {
+			t.Errorf("%s %v: got %p, %v, want %p", tt.name, tt.protos, cert, err, tt.want)
+		}
+	}
+
+	r.SetChallengeCertificate("a.example", nil)
+	chi := &tls.ClientHelloInfo{ServerName: "a.example", SupportedProtos: []string{ACMETLS1Protocol}}
+	if cert, _ := r.GetCertificate(chi); cert != r.Get() {
+		t.Error("removed challenge certificate is still served")
+	}
+}
+
+func TestACMEState(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	state := r.ACMEState()
+	certPEM, keyPEM := newTestPair(t, "a.example")
+	challenge, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge.Leaf = nil
+	if err = state.Register("A.example", &challenge); err != nil {
+		t.Fatal(err)
+	}
+	if err = state.Register("b.example", &tls.Certificate{Certificate: challenge.Certificate}); err != errInvalidChallenge {
+		t.Errorf("got %v without private key, want %v", err, errInvalidChallenge)
+	}
+	if got := state.Pending(); !reflect.DeepEqual(got, []string{"a.example"}) {
+		t.Errorf("got pending %q", got)
+	}
+
+	chi := &tls.ClientHelloInfo{ServerName: "a.example", SupportedProtos: []string{ACMETLS1Protocol}}
+	config, err := r.GetConfigForClient(chi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) != 1 || config.Certificates[0].Leaf == nil ||
+		!reflect.DeepEqual(config.Certificates[0].Certificate, challenge.Certificate) ||
+		!reflect.DeepEqual(config.NextProtos, []string{ACMETLS1Protocol}) {
+		t.Errorf("got config serving %+v for %v", config.Certificates, config.NextProtos)
+	}
+	// Reloads leave challenges alone.
+	writeTestPair(t, filepath.Dir(r.CertPath()), "example")
+	if _, err = r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := r.GetCertificate(chi); cert.Leaf.Subject.CommonName != "a.example" {
+		t.Error("challenge certificate lost by reload")
+	}
+
+	if !state.Deregister("a.example") || state.Deregister("a.example") {
+		t.Error("Deregister did not report pending challenge")
+	}
+	if cert, _ := r.GetCertificate(chi); cert != r.Get() {
+		t.Error("deregistered challenge certificate is still served")
+	}
+}
@@ -0,0 +1,37 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+// BindConfig keeps config.Certificates in sync with currently loaded
+// certificate, for libraries which read tls.Config.Certificates instead of
+// calling GetCertificate. It is updated right away and on every reload that
+// installs a new certificate, while holding the lock returned by
+// BoundConfigLocker. Concurrent readers of the slice must hold the same lock,
+// since tls.Config itself is not synchronized; handshakes inside crypto/tls
+// do not, so prefer GetCertificate wherever possible.
+func (r *Reloader) BindConfig(config *tls.Config) {
+	r.bindMu.Lock()
+	defer r.bindMu.Unlock()
+	r.bound = append(r.bound, config)
+	if !r.certOnly {
+		config.Certificates = r.snapshot().certificates()
+	}
+}
+
+// BoundConfigLocker returns the lock held while updating configs passed to
+// BindConfig.
+func (r *Reloader) BoundConfigLocker() sync.Locker {
+	return &r.bindMu
+}
+
+// updateBound updates configs passed to BindConfig with certs.
+func (r *Reloader) updateBound(certs []tls.Certificate) {
+	r.bindMu.Lock()
+	defer r.bindMu.Unlock()
+	for _, config := range r.bound {
+		config.Certificates = certs
+	}
+}
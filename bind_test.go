@@ -0,0 +1,73 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+func TestBindConfig(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	r, err := New(certPath, keyPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	config := &tls.Config{}
+	r.BindConfig(config)
+	if len(config.Certificates) != 1 || !config.Certificates[0].Leaf.Equal(r.Leaf()) {
+		t.Fatal("bound config not updated right away")
+	}
+
+	// Reloads update bound configs while holding BoundConfigLocker.
+	writeTestPair(t, dir, "rotated")
+	locker := r.BoundConfigLocker()
+	locker.Lock()
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Reload()
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		t.Fatalf("reload finished with bound configs locked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if cn := config.Certificates[0].Leaf.Subject.CommonName; cn != "example" {
+		t.Errorf("bound config updated to %q without lock", cn)
+	}
+	locker.Unlock()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	locker.Lock()
+	cn := config.Certificates[0].Leaf.Subject.CommonName
+	locker.Unlock()
+	if cn != "rotated" {
+		t.Errorf("bound config serves %q after reload, want rotated", cn)
+	}
+
+	// Reloads not installing anything leave bound configs alone.
+	config.Certificates = nil
+	if _, err = r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if config.Certificates != nil {
+		t.Error("bound config updated by unchanged reload")
+	}
+}
+
+func TestBindConfigCertOnly(t *testing.T) {
+	certPath, _ := writeTestPair(t, t.TempDir(), "example")
+	r, err := NewCertOnly(certPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	config := &tls.Config{}
+	r.BindConfig(config)
+	if config.Certificates != nil {
+		t.Error("bound config given certificates in certificate-only mode")
+	}
+}
@@ -0,0 +1,124 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NewFromBundle return a new Reloader for a single PEM file containing several
+// leaf certificates, each followed by its chain, and their private keys in any
+// order, e.g. old and new certificate during a migration. The first
+// certificate, and any other one matching a private key, starts a new chain.
+// Each leaf is paired with the private key matching it, and a reload fails if
+// any leaf, i.e. a certificate not issuing the one before it, has none.
+// All pairs are served: GetCertificate selects the first one supported by the
+// client (see tls.ClientHelloInfo.SupportsCertificate), as crypto/tls does
+// for tls.Config.Certificates, and falls back to the first one. Get, Leaf and
+// the like refer to the first pair. Otherwise it works like New.
+func NewFromBundle(bundlePath string, interval time.Duration, opts ...Option) (*Reloader, error) {
+	if bundlePath == "" {
+		return nil, errInvalidCertPath
+	}
+	opts = append([]Option{func(r *Reloader) { r.bundle = true }}, opts...)
+	return newReloader(pathSource(bundlePath), pathSource(bundlePath), interval, opts)
+}
+
+// parseBundle pairs each leaf certificate of bundlePEM, along with the
+// certificates following it, with its private key in bundlePEM. A leaf is the
+// first certificate or any one matching a private key, regardless of basic
+// constraints, since self-signed leaves commonly claim to be a CA. Any other
+// certificate must be named as issuer by the one before it.
+func parseBundle(bundlePEM []byte) (certs []tls.Certificate, err error) {
+	var certBlocks []*pem.Block
+	var keys [][]byte
+	for {
+		var block *pem.Block
+		block, bundlePEM = pem.Decode(bundlePEM)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			certBlocks = append(certBlocks, block)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			keys = append(keys, pem.EncodeToMemory(block))
+		}
+	}
+	if len(certBlocks) == 0 {
+		return nil, errNoCertificatePEM
+	}
+
+	type chain struct {
+		leaf *x509.Certificate
+		pem  []byte // of leaf and its chain
+		key  []byte // nil if none matches
+	}
+	var chains []chain
+	var prev *x509.Certificate
+	for i, block := range certBlocks {
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		issuesPrev := prev != nil && bytes.Equal(c.RawSubject, prev.RawIssuer)
+		prev = c
+		certPEM := pem.EncodeToMemory(block)
+		var key []byte
+		for _, keyPEM := range keys {
+			if _, err := tls.X509KeyPair(certPEM, keyPEM); err == nil {
+				key = keyPEM
+				break
+			}
+		}
+		switch {
+		case i == 0 || key != nil:
+			chains = append(chains, chain{leaf: c, key: key})
+		case !issuesPrev:
+			return nil, fmt.Errorf("%w: no private key for %s", ErrKeyMismatch, summary(c))
+		}
+		last := &chains[len(chains)-1]
+		last.pem = append(last.pem, certPEM...)
+	}
+	for _, c := range chains {
+		if c.key == nil {
+			return nil, fmt.Errorf("%w: no private key for %s", ErrKeyMismatch, summary(c.leaf))
+		}
+		cert, err := tls.X509KeyPair(c.pem, c.key)
+		if err != nil {
+			return nil, err
+		}
+		cert.Leaf = c.leaf
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// certificates returns all certificates of snap, the primary one first.
+func (snap *snapshot) certificates() []tls.Certificate {
+	certs := []tls.Certificate{*snap.cert}
+	for _, alt := range snap.alts {
+		certs = append(certs, *alt)
+	}
+	return certs
+}
+
+// selectCertificate returns the first certificate of snap supported by chi.
+func (snap *snapshot) selectCertificate(chi *tls.ClientHelloInfo) *tls.Certificate {
+	if len(snap.alts) == 0 || chi == nil {
+		return snap.cert
+	}
+	if chi.SupportsCertificate(snap.cert) == nil {
+		return snap.cert
+	}
+	for _, alt := range snap.alts {
+		if chi.SupportsCertificate(alt) == nil {
+			return alt
+		}
+	}
+	return snap.cert
+}
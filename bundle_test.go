@@ -0,0 +1,93 @@
+package certreloader
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewFromBundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.pem")
+	oldCert, oldKey := newTestPair(t, "old.example")
+	newCert, newKey := newTestPair(t, "new.example")
+	var bundle []byte
+	for _, b := range [][]byte{oldCert, newCert, newKey, oldKey} {
+		bundle = append(bundle, b...)
+	}
+	writeTestFile(t, path, bundle)
+
+	r, err := NewFromBundle(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	for _, name := range []string{"old.example", "new.example"} {
+		cert, err := r.GetCertificate(&tls.ClientHelloInfo{
+			ServerName:        name,
+			SupportedVersions: []uint16{tls.VersionTLS13},
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cn := cert.Leaf.Subject.CommonName; cn != name {
+			t.Errorf("got certificate for %q, want %q", cn, name)
+		}
+	}
+	if n := len(r.snapshot().config.Certificates); n != 2 {
+		t.Errorf("got %d certificates in config, want 2", n)
+	}
+
+	writeTestFile(t, path, append(oldCert, newKey...))
+	if _, err := r.Reload(); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("got %v, want %v", err, ErrKeyMismatch)
+	}
+}
+
+func TestBundleCALeaf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.pem")
+	keyPEM := func(key *ecdsa.PrivateKey) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	// A self-signed leaf claiming to be a CA, as common for internal
+	// services, followed by a leaf with its chain.
+	selfPEM, _, selfKey := issueTestCert(t, "internal.example", true, nil, nil)
+	rootPEM, root, rootKey := issueTestCert(t, "root", true, nil, nil)
+	interPEM, inter, interKey := issueTestCert(t, "intermediate", true, root, rootKey)
+	leafPEM, _, leafKey := issueTestCert(t, "web.example", false, inter, interKey)
+	var bundle []byte
+	for _, b := range [][]byte{selfPEM, leafPEM, interPEM, rootPEM, keyPEM(leafKey), keyPEM(selfKey)} {
+		bundle = append(bundle, b...)
+	}
+	writeTestFile(t, path, bundle)
+
+	r, err := NewFromBundle(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	certs := r.snapshot().certificates()
+	if len(certs) != 2 || certs[0].Leaf.Subject.CommonName != "internal.example" || len(certs[0].Certificate) != 1 ||
+		certs[1].Leaf.Subject.CommonName != "web.example" || len(certs[1].Certificate) != 3 {
+		t.Fatalf("got %d certificates", len(certs))
+	}
+
+	// A leaf without its key is not mistaken for part of a chain.
+	bundle = nil
+	for _, b := range [][]byte{selfPEM, leafPEM, interPEM, keyPEM(selfKey)} {
+		bundle = append(bundle, b...)
+	}
+	writeTestFile(t, path, bundle)
+	if _, err := r.Reload(); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("got %v, want %v", err, ErrKeyMismatch)
+	}
+}
@@ -0,0 +1,129 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ParseCache shares parsed certificates among Reloaders reading the same
+// files, e.g. a wildcard certificate used by many virtual servers, so that
+// they are parsed once per change instead of once per Reloader. Entries are
+// keyed by file names, parsing options and digests of their contents, so a
+// change of contents is never served from the cache. Only the parse of the most recent contents
+// is kept per set of files. It is safe for concurrent use.
+type ParseCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	mu       sync.Mutex // held while parsing
+	dgsts    [4]uint64
+	certs    []tls.Certificate
+	warnings []error
+}
+
+// NewParseCache returns an empty ParseCache, to be passed to WithParseCache
+// of Reloaders that should share it.
+func NewParseCache() *ParseCache {
+	return &ParseCache{entries: make(map[string]*cacheEntry)}
+}
+
+// parse returns the certificates and warnings cached under name and dgsts, or
+// calls parse and caches its result if it succeeds. Concurrent callers for the
+// same name wait for a single parse.
+func (c *ParseCache) parse(name string, dgsts [4]uint64, parse func() ([]tls.Certificate, []error, error)) ([]tls.Certificate, []error, error) {
+	c.mu.Lock()
+	e := c.entries[name]
+	if e == nil {
+		e = &cacheEntry{}
+		c.entries[name] = e
+	}
+	c.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.certs != nil && e.dgsts == dgsts {
+		return e.certs, e.warnings, nil
+	}
+	certs, warnings, err := parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	e.dgsts, e.certs, e.warnings = dgsts, certs, warnings
+	return certs, warnings, nil
+}
+
+// cacheName identifies the files parsed by r, and how they are parsed, so that
+// Reloaders configured differently never share a parse.
+func (r *Reloader) cacheName() string {
+	names := []string{r.certSrc.name()}
+	if r.bundle {
+		names[0] = "bundle:" + names[0]
+	}
+	for _, src := range r.keySources() {
+		names = append(names, src.name())
+	}
+	for _, src := range r.chainSrcs {
+		names = append(names, src.name())
+	}
+	return strings.Join(append(names, r.parseSettings()), "\x00")
+}
+
+// parseSettings describes the options of r affecting how its files are parsed
+// and whether the result is accepted.
+func (r *Reloader) parseSettings() string {
+	var b strings.Builder
+	if r.pkcs7 {
+		b.WriteString("pkcs7;")
+	}
+	if r.base64Key {
+		b.WriteString("base64key;")
+	}
+	if r.fixedKey != nil {
+		b.WriteString("fixedkey;")
+	}
+	if p := r.keyPolicy; p != nil {
+		fmt.Fprintf(&b, "keypolicy=%d,%t", p.MinRSABits, p.DenyEd25519)
+		for _, curve := range p.ECDSACurves {
+			b.WriteString("," + curve.Params().Name)
+		}
+		b.WriteString(";")
+	}
+	if p := r.parsePolicy; p != nil {
+		fmt.Fprintf(&b, "parsepolicy=%+v;", *p)
+	}
+	return b.String()
+}
+
+// forget drops the entry cached under name.
+func (c *ParseCache) forget(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, name)
+}
+
+// ResetCache forgets the digests, file stamps and generation of the last
+// successful reload, as well as parsed certificates shared through
+// WithParseCache, so that the next reload reads and parses all files
+// unconditionally and installs them even if they did not change, e.g. after
+// recovering from a corrupt state. The loaded certificate keeps being served,
+// and background reloading is not interrupted; call Reload afterwards for an
+// immediate re-evaluation.
+func (r *Reloader) ResetCache() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certDgst, r.keyDgst = 0, 0
+	r.stapleDgst, r.issuerDgst, r.caDgst, r.chainDgst, r.passDgst = 0, 0, 0, 0, 0
+	r.certStamp, r.keyStamp, r.triggerStamp = fileStamp{}, fileStamp{}, fileStamp{}
+	r.forceNext = true
+	r.keySkips = 0
+	r.genSeen = false
+	zero(r.prevKeyPEM)
+	r.prevCertPEM, r.prevKeyPEM = nil, nil
+	if r.parseCache != nil {
+		r.parseCache.forget(r.cacheName())
+	}
+}
@@ -0,0 +1,122 @@
+package certreloader
+
+import (
+	"crypto/elliptic"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCache(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "old.example")
+	cache := NewParseCache()
+	var rs []*Reloader
+	for i := 0; i < 2; i++ {
+		r, err := New(certPath, keyPath, time.Hour, WithParseCache(cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+		rs = append(rs, r)
+	}
+	if rs[0].Leaf() != rs[1].Leaf() {
+		t.Error("certificate parsed twice")
+	}
+
+	writeTestPair(t, dir, "new.example")
+	for _, r := range rs {
+		if res, err := r.Reload(); err != nil || !res.Changed {
+			t.Fatalf("got %+v, %v", res, err)
+		}
+	}
+	if rs[0].Leaf() != rs[1].Leaf() || rs[0].Leaf().Subject.CommonName != "new.example" {
+		t.Error("changed certificate not shared")
+	}
+}
+
+func TestParseCacheSettings(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	cache := NewParseCache()
+	plain, err := New(certPath, keyPath, time.Hour, WithParseCache(cache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Stop()
+	strict, err := New(certPath, keyPath, time.Hour, WithParseCache(cache),
+		WithKeyPolicy(KeyPolicy{ECDSACurves: []elliptic.Curve{elliptic.P384()}}))
+	if err == nil {
+		strict.Stop()
+		t.Fatal("key policy bypassed through shared cache")
+	}
+	relaxed, err := New(certPath, keyPath, time.Hour, WithParseCache(cache),
+		WithParsePolicy(ParsePolicy{RequireSAN: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relaxed.Stop()
+	if relaxed.Leaf() == plain.Leaf() {
+		t.Error("parse shared by differently configured Reloaders")
+	}
+	if n := len(cache.entries); n != 3 {
+		t.Errorf("got %d cache entries, want one per configuration", n)
+	}
+}
+
+func TestParseCacheWarnings(t *testing.T) {
+	dir := t.TempDir()
+	certPath, newKeyPath := writeTestPair(t, dir, "example")
+	_, oldKeyPEM := newTestPair(t, "example")
+	oldKeyPath := filepath.Join(dir, "old.pem")
+	writeTestFile(t, oldKeyPath, oldKeyPEM)
+	cache := NewParseCache()
+	for i := 0; i < 2; i++ {
+		var warnings []error
+		r, err := NewWithKeys(certPath, []string{oldKeyPath, newKeyPath}, time.Hour, WithParseCache(cache),
+			WithOnWarning(func(err error) { warnings = append(warnings, err) }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+		if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), newKeyPath) {
+			t.Errorf("reloader %d: got warnings %v, want pairing with %s", i, warnings, newKeyPath)
+		}
+	}
+}
+
+func TestResetCache(t *testing.T) {
+	triggerPath := filepath.Join(t.TempDir(), "trigger")
+	writeTestFile(t, triggerPath, nil)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"parse cache", []Option{WithParseCache(NewParseCache())}},
+		{"comparator", []Option{WithChangeComparator(func(_, _, _, _ []byte) bool { return false })}},
+		{"trigger file", []Option{WithTriggerFile(triggerPath)}},
+		{"missing trigger file", []Option{WithTriggerFile(filepath.Join(t.TempDir(), "missing"))}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestReloader(t, tc.opts...)
+			defer r.Stop()
+			old := r.Leaf()
+			if res, err := r.Reload(); err != nil || res.Changed {
+				t.Fatalf("got %+v, %v without changes", res, err)
+			}
+			r.ResetCache()
+			res, err := r.Reload()
+			if err != nil || !res.Changed {
+				t.Fatalf("got %+v, %v after ResetCache", res, err)
+			}
+			if r.Leaf() == old {
+				t.Error("certificate not parsed again")
+			}
+			if res, err = r.Reload(); err != nil || res.Changed {
+				t.Errorf("got %+v, %v after reinstalling", res, err)
+			}
+		})
+	}
+}
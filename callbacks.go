@@ -0,0 +1,161 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"log"
+	"time"
+)
+
+// SetOnReload replaces the function called after a reload installed a new
+// certificate. A nil fn removes the callback. It is safe to call while reloads
+// are happening; each reload sees either the old or the new function.
+func (r *Reloader) SetOnReload(fn func(*tls.Certificate)) {
+	r.onReload.Store(fn)
+}
+
+// SetOnError replaces the function called when a reload failed. A nil fn
+// removes the callback, and failures of background reloading will be logged
+// again. It is safe to call while reloads are happening.
+func (r *Reloader) SetOnError(fn func(error)) {
+	r.onError.Store(fn)
+}
+
+// SetOnWarning replaces the function called for problems which do not prevent
+// a certificate from being used. A nil fn removes the callback, and warnings
+// will be logged again. It is safe to call while reloads are happening.
+func (r *Reloader) SetOnWarning(fn func(error)) {
+	r.onWarning.Store(fn)
+}
+
+// SetOnRecover replaces the function called on the first successful reload
+// after one or more failed ones, with the error of the last failure. A nil fn
+// removes the callback; recovery is logged either way. It is safe to call
+// while reloads are happening.
+func (r *Reloader) SetOnRecover(fn func(error)) {
+	r.onRecover.Store(fn)
+}
+
+// ReloadInfo describes a reload attempt, for feeding metrics or logs of any
+// backend. See SetObserver.
+type ReloadInfo struct {
+	// Start is when the reload started, after waiting for concurrent ones.
+	Start time.Time
+	// Duration is how long the reload took.
+	Duration time.Duration
+	// ChangeDetected reports whether files were found different from those
+	// of last successful reload, and therefore parsed. It is always true for
+	// the initial load.
+	ChangeDetected bool
+	// Swapped reports whether a new certificate was installed.
+	Swapped bool
+	// Reason is the same as ReloadResult.Reason.
+	Reason string
+	// Err is the error of a failed reload.
+	Err error
+	// OldFingerprint is the fingerprint of the leaf certificate loaded before
+	// the reload in hex, by SHA-256 unless changed by WithFingerprintHash, or
+	// empty for the initial load.
+	OldFingerprint string
+	// NewFingerprint is the fingerprint of the leaf certificate parsed from
+	// changed files, even if it was rejected or not installed in dry run, or
+	// empty if nothing was parsed.
+	NewFingerprint string
+}
+
+// SetObserver replaces the function called after every reload attempt,
+// including the initial load and failed ones, but not ticks skipped by Pause
+// or a reload guard. A nil fn removes it. It is called before other callbacks,
+// not holding any lock. It is safe to call while reloads are happening.
+func (r *Reloader) SetObserver(fn func(ReloadInfo)) {
+	r.observer.Store(fn)
+}
+
+func (r *Reloader) loadOnReload() func(*tls.Certificate) {
+	fn, _ := r.onReload.Load().(func(*tls.Certificate))
+	return fn
+}
+
+func (r *Reloader) loadOnError() func(error) {
+	fn, _ := r.onError.Load().(func(error))
+	return fn
+}
+
+func (r *Reloader) loadOnWarning() func(error) {
+	fn, _ := r.onWarning.Load().(func(error))
+	return fn
+}
+
+func (r *Reloader) loadOnRecover() func(error) {
+	fn, _ := r.onRecover.Load().(func(error))
+	return fn
+}
+
+func (r *Reloader) loadObserver() func(ReloadInfo) {
+	fn, _ := r.observer.Load().(func(ReloadInfo))
+	return fn
+}
+
+// observe passes the outcome of a reload to the observer, if any, and records
+// it in history. Like notify, it must not be called with r.mu held.
+func (r *Reloader) observe(res ReloadResult, err error) {
+	fn := r.loadObserver()
+	if fn == nil && r.history == nil {
+		return
+	}
+	info := ReloadInfo{
+		Start:          res.start,
+		Duration:       res.elapsed,
+		ChangeDetected: res.detected,
+		Swapped:        res.Changed,
+		Reason:         res.Reason,
+		Err:            err,
+	}
+	if res.oldLeaf != nil {
+		info.OldFingerprint = r.fingerprint(res.oldLeaf)
+	}
+	if res.candidate != nil {
+		info.NewFingerprint = r.fingerprint(res.candidate)
+	}
+	if r.history != nil {
+		r.history.add(info)
+	}
+	if fn != nil {
+		fn(info)
+	}
+}
+
+// notify invokes callbacks for the outcome of a reload. It must not be called
+// with r.mu held, so that callbacks are free to call Reload.
+func (r *Reloader) notify(res ReloadResult, err error) {
+	r.warn(res.warnings...)
+	if err != nil {
+		if fn := r.loadOnError(); fn != nil {
+			fn(err)
+		}
+		return
+	}
+	if res.recovered != nil {
+		log.Printf("recovered from reload failure: %v", res.recovered)
+		if fn := r.loadOnRecover(); fn != nil {
+			fn(res.recovered)
+		}
+	}
+	if res.Changed {
+		if !r.certOnly {
+			r.updateBound(r.snapshot().certificates())
+		}
+		if fn := r.loadOnReload(); fn != nil {
+			fn(r.current())
+		}
+	}
+}
+
+func (r *Reloader) warn(warnings ...error) {
+	for _, w := range warnings {
+		if fn := r.loadOnWarning(); fn != nil {
+			fn(w)
+		} else {
+			log.Print(w)
+		}
+	}
+}
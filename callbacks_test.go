@@ -0,0 +1,285 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOnRecover(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	var recovered []string
+	r, err := New(certPath, keyPath, time.Hour, WithOnError(func(error) {}), WithOnRecover(func(err error) {
+		recovered = append(recovered, errString(err))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	writeTestFile(t, certPath, []byte("garbage"))
+	r.Reload()
+	_, lastErr := r.Reload()
+	if lastErr == nil {
+		t.Fatal("reload of garbage succeeded")
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	writeTestPair(t, dir, "example")
+	r.Reload()
+	r.Reload()
+	if len(recovered) != 1 || recovered[0] != lastErr.Error() {
+		t.Errorf("got %q, want [%q]", recovered, lastErr)
+	}
+	if n := strings.Count(buf.String(), "recovered from reload failure"); n != 1 {
+		t.Errorf("logged recovery %d times along with OnRecover, want once", n)
+	}
+}
+
+// TestSetCallbacks replaces and clears each callback while reloads happen
+// concurrently, which should be free of data races.
+func TestSetCallbacks(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	// Pairing with the second candidate key makes each change warn.
+	_, otherKeyPEM := newTestPair(t, "example")
+	otherKeyPath := filepath.Join(dir, "other.pem")
+	writeTestFile(t, otherKeyPath, otherKeyPEM)
+	r, err := NewWithKeys(certPath, []string{otherKeyPath, keyPath}, time.Hour, WithOnWarning(func(error) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// cycle fails a reload by garbage, and recovers by a new pair.
+	cycle := func() {
+		writeTestFile(t, certPath, []byte("garbage"))
+		r.Reload()
+		writeTestPair(t, dir, "example")
+		r.Reload()
+	}
+	var reloads, errs, warnings, recoveries, observed atomic.Int32
+	set := func(enable bool) {
+		if !enable {
+			r.SetOnReload(nil)
+			r.SetOnError(nil)
+			r.SetOnWarning(func(error) {})
+			r.SetOnRecover(nil)
+			r.SetObserver(nil)
+			return
+		}
+		r.SetOnReload(func(*tls.Certificate) { reloads.Add(1) })
+		r.SetOnError(func(error) { errs.Add(1) })
+		r.SetOnWarning(func(error) { warnings.Add(1) })
+		r.SetOnRecover(func(error) { recoveries.Add(1) })
+		r.SetObserver(func(ReloadInfo) { observed.Add(1) })
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			cycle()
+		}
+	}()
+	for i, running := 0, true; running; i++ {
+		set(i%2 == 0)
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+	}
+
+	// Events after the last replacement reach the new callbacks.
+	set(true)
+	for _, c := range []*atomic.Int32{&reloads, &errs, &warnings, &recoveries, &observed} {
+		c.Store(0)
+	}
+	cycle()
+	for _, tc := range []struct {
+		name string
+		got  int32
+		want int32
+	}{
+		{"OnReload", reloads.Load(), 1},
+		{"OnError", errs.Load(), 1},
+		{"OnWarning", warnings.Load(), 1},
+		{"OnRecover", recoveries.Load(), 1},
+		{"Observer", observed.Load(), 2},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s called %d times, want %d", tc.name, tc.got, tc.want)
+		}
+	}
+
+	// Cleared callbacks are not called.
+	set(false)
+	observed.Store(0)
+	cycle()
+	if got := observed.Load(); got != 0 {
+		t.Errorf("cleared observer called %d times", got)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	var infos []ReloadInfo
+	r, err := New(certPath, keyPath, time.Hour, WithOnError(func(error) {}), WithObserver(func(info ReloadInfo) {
+		infos = append(infos, info)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	first := fingerprint(r.Leaf())
+
+	r.Reload()
+	writeTestPair(t, dir, "example")
+	r.Reload()
+	second := fingerprint(r.Leaf())
+	_, otherKeyPEM := newTestPair(t, "example")
+	writeTestFile(t, keyPath, otherKeyPEM)
+	r.Reload()
+
+	for i, want := range []ReloadInfo{
+		{ChangeDetected: true, Swapped: true, Reason: reasonInstalled, NewFingerprint: first},
+		{Reason: reasonUnchanged, OldFingerprint: first},
+		{ChangeDetected: true, Swapped: true, Reason: reasonInstalled, OldFingerprint: first, NewFingerprint: second},
+		{ChangeDetected: true, Reason: reasonRejected, OldFingerprint: second},
+	} {
+		if i >= len(infos) {
+			t.Fatalf("got %d reloads, want 4", len(infos))
+		}
+		got := infos[i]
+		if got.Start.IsZero() || got.Duration <= 0 || (got.Err != nil) != (want.Reason == reasonRejected) {
+			t.Errorf("reload %d: got start %v, duration %v, error %v", i, got.Start, got.Duration, got.Err)
+		}
+		got.Start, got.Duration, got.Err = time.Time{}, 0, nil
+		if got != want {
+			t.Errorf("reload %d: got %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	r, err := New(certPath, keyPath, time.Hour, WithHistorySize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got := r.History(); len(got) != 1 || got[0].Reason != reasonInstalled {
+		t.Fatalf("got %+v, want initial load", got)
+	}
+	r.Reload()
+	writeTestPair(t, dir, "example")
+	r.Reload()
+	got := r.History()
+	if len(got) != 2 || got[0].Reason != reasonUnchanged || got[1].Reason != reasonInstalled {
+		t.Fatalf("got %+v, want last 2 reloads", got)
+	}
+	if got[1].NewFingerprint != fingerprint(r.Leaf()) {
+		t.Errorf("got fingerprint %s, want %s", got[1].NewFingerprint, fingerprint(r.Leaf()))
+	}
+
+	r, err = New(certPath, keyPath, time.Hour, WithHistorySize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got := r.History(); got != nil {
+		t.Errorf("got %+v, want history disabled", got)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	var hookPanics bool
+	var errs []error
+	r, err := New(certPath, keyPath, time.Hour,
+		WithPreParseHook(func(certPEM, keyPEM []byte) error {
+			if hookPanics {
+				panic("buggy hook")
+			}
+			return nil
+		}),
+		WithOnError(func(err error) { errs = append(errs, err) }),
+		WithOnReload(func(*tls.Certificate) { panic("buggy callback") }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	old := r.Get()
+
+	hookPanics = true
+	writeTestPair(t, dir, "example")
+	if res, err := r.Reload(); !errors.Is(err, errPanic) || res.Reason != reasonPanicked {
+		t.Errorf("got %q, %v, want %v", res.Reason, err, errPanic)
+	}
+	if r.Get() != old {
+		t.Error("certificate replaced by panicking reload")
+	}
+
+	hookPanics = false
+	errs = nil
+	r.tick()
+	if r.Get() == old {
+		t.Error("certificate not reloaded")
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], errPanic) {
+		t.Errorf("got %v, want panic of callback reported", errs)
+	}
+	if _, err := r.Reload(); err != nil {
+		t.Errorf("reload after recovered panic: %v", err)
+	}
+}
+
+func TestOnReloadReentrant(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	var r *Reloader
+	var nested []error
+	r, err := New(certPath, keyPath, time.Hour, WithOnReload(func(*tls.Certificate) {
+		if r != nil {
+			_, err := r.Reload()
+			nested = append(nested, err)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// Reloading from the callback neither deadlocks nor recurses, since the
+	// files are unchanged by then.
+	writeTestPair(t, dir, "rotated")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.tick()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("reloading from OnReload deadlocked")
+	}
+	if len(nested) != 1 || nested[0] != nil {
+		t.Errorf("got nested reloads %v", nested)
+	}
+}
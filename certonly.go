@@ -0,0 +1,44 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"time"
+)
+
+var (
+	errCertOnly         = errors.New("no private key in certificate-only mode")
+	errNoCertificatePEM = errors.New("failed to find certificate PEM data")
+)
+
+// NewCertOnly return a new Reloader which loads only a certificate (and its
+// chain) without private key, e.g. to monitor its expiry. Leaf, Chain and
+// callbacks work as usual, while Get returns nil and GetCertificate returns an
+// error, since there is nothing usable for serving. Callbacks set by
+// WithOnReload receive a tls.Certificate without PrivateKey.
+func NewCertOnly(certPath string, interval time.Duration, opts ...Option) (*Reloader, error) {
+	if certPath == "" {
+		return nil, errInvalidCertPath
+	}
+	return newReloader(pathSource(certPath), nil, interval, opts)
+}
+
+// parseCertificates parses all CERTIFICATE blocks of certPEM into a
+// tls.Certificate without private key.
+func parseCertificates(certPEM []byte) (cert tls.Certificate, err error) {
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		err = errNoCertificatePEM
+	}
+	return
+}
@@ -0,0 +1,326 @@
+package certreloader
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	errInvalidCertStore   = errors.New("either thumbprint or subject of certificate store is required")
+	errCertStoreNotFound  = errors.New("no matching certificate in certificate store")
+	errUnsupportedKeyType = errors.New("unsupported key type in certificate store")
+)
+
+// CertStore selects a certificate, along with its private key, from a Windows
+// system certificate store.
+type CertStore struct {
+	// Name of the system store, e.g. "MY" for personal certificates. It
+	// defaults to "MY".
+	Name string
+	// LocalMachine selects the store of local machine instead of current
+	// user.
+	LocalMachine bool
+	// Thumbprint is the hex encoded SHA-1 hash of certificate to be loaded.
+	Thumbprint string
+	// Subject is matched against subject names of certificates if Thumbprint
+	// is empty, and the one expiring last is loaded, so that a renewed
+	// certificate is picked up.
+	Subject string
+}
+
+// NewFromCertStore return a new Reloader for a certificate and its private key
+// in a Windows certificate store. The private key is never exported; it is
+// used for signing through CNG, and may be non-exportable or backed by
+// hardware. Only the leaf certificate is served, without chain. The store is
+// polled on each reload, and failures to open or find in it are handled like
+// read failures of files.
+func NewFromCertStore(store CertStore, interval time.Duration, opts ...Option) (*Reloader, error) {
+	if store.Thumbprint == "" && store.Subject == "" {
+		return nil, errInvalidCertStore
+	}
+	if store.Name == "" {
+		store.Name = "MY"
+	}
+	return newReloader(certStoreSource{store}, certStoreKey{store}, interval, opts)
+}
+
+func (s CertStore) String() string {
+	loc := "CurrentUser"
+	if s.LocalMachine {
+		loc = "LocalMachine"
+	}
+	sel := s.Thumbprint
+	if sel == "" {
+		sel = "subject=" + s.Subject
+	}
+	return `cert:\` + loc + `\` + s.Name + `\` + sel
+}
+
+// find returns the DER of selected certificate.
+func (s CertStore) find() ([]byte, error) {
+	if s.Thumbprint != "" {
+		hash, err := hex.DecodeString(s.Thumbprint)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid thumbprint: %w", s, err)
+		}
+		return s.findHash(hash)
+	}
+	store, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CertCloseStore(store, 0)
+	subject, err := windows.UTF16PtrFromString(s.Subject)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ctx      *windows.CertContext
+		der      []byte
+		notAfter time.Time
+	)
+	for {
+		// ctx passed in is freed by CertFindCertificateInStore.
+		ctx, err = windows.CertFindCertificateInStore(store, windows.X509_ASN_ENCODING|windows.PKCS_7_ASN_ENCODING, 0, windows.CERT_FIND_SUBJECT_STR, unsafe.Pointer(subject), ctx)
+		if ctx == nil {
+			break
+		}
+		leaf, err := x509.ParseCertificate(encoded(ctx))
+		if err == nil && leaf.NotAfter.After(notAfter) {
+			der = append([]byte(nil), leaf.Raw...)
+			notAfter = leaf.NotAfter
+		}
+	}
+	if der == nil {
+		if err == nil || errors.Is(err, windows.Errno(windows.CRYPT_E_NOT_FOUND)) {
+			err = errCertStoreNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", s, err)
+	}
+	return der, nil
+}
+
+// findHash returns the DER of certificate with SHA-1 hash.
+func (s CertStore) findHash(hash []byte) ([]byte, error) {
+	ctx, err := s.findContext(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CertFreeCertificateContext(ctx)
+	return append([]byte(nil), encoded(ctx)...), nil
+}
+
+func (s CertStore) findContext(hash []byte) (*windows.CertContext, error) {
+	store, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CertCloseStore(store, 0)
+	blob := windows.CryptHashBlob{Size: uint32(len(hash)), Data: &hash[0]}
+	ctx, err := windows.CertFindCertificateInStore(store, windows.X509_ASN_ENCODING|windows.PKCS_7_ASN_ENCODING, 0, windows.CERT_FIND_HASH, unsafe.Pointer(&blob), nil)
+	if ctx == nil {
+		if err == nil || errors.Is(err, windows.Errno(windows.CRYPT_E_NOT_FOUND)) {
+			err = errCertStoreNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", s, err)
+	}
+	return ctx, nil
+}
+
+func (s CertStore) open() (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(s.Name)
+	if err != nil {
+		return 0, err
+	}
+	flags := uint32(windows.CERT_SYSTEM_STORE_CURRENT_USER)
+	if s.LocalMachine {
+		flags = windows.CERT_SYSTEM_STORE_LOCAL_MACHINE
+	}
+	store, err := windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM_W, 0, 0, flags|windows.CERT_STORE_READONLY_FLAG, uintptr(unsafe.Pointer(name)))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", s, err)
+	}
+	return store, nil
+}
+
+func encoded(ctx *windows.CertContext) []byte {
+	return unsafe.Slice(ctx.EncodedCert, ctx.Length)
+}
+
+// certStoreSource reads the selected certificate as PEM.
+type certStoreSource struct {
+	store CertStore
+}
+
+func (s certStoreSource) read(ctx context.Context, limit int64) ([]byte, error) {
+	der, err := s.store.find()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+func (s certStoreSource) name() string {
+	return s.store.String()
+}
+
+// certStoreKey reads the same as certStoreSource, since the private key is
+// bound to the certificate, and provides the key as a crypto.Signer.
+type certStoreKey struct {
+	store CertStore
+}
+
+func (s certStoreKey) read(ctx context.Context, limit int64) ([]byte, error) {
+	return certStoreSource(s).read(ctx, limit)
+}
+
+func (s certStoreKey) name() string {
+	return s.store.String()
+}
+
+func (s certStoreKey) signer(leaf *x509.Certificate) (crypto.Signer, error) {
+	switch leaf.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("%s: %w %T", s.store, errUnsupportedKeyType, leaf.PublicKey)
+	}
+	hash := sha1.Sum(leaf.Raw)
+	ctx, err := s.store.findContext(hash[:])
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CertFreeCertificateContext(ctx)
+	var (
+		key      windows.Handle
+		keySpec  uint32
+		mustFree bool
+	)
+	flags := uint32(windows.CRYPT_ACQUIRE_ONLY_NCRYPT_KEY_FLAG | windows.CRYPT_ACQUIRE_SILENT_FLAG)
+	if err = windows.CryptAcquireCertificatePrivateKey(ctx, flags, nil, &key, &keySpec, &mustFree); err != nil {
+		return nil, fmt.Errorf("%s: private key: %w", s.store, err)
+	}
+	k := &cngKey{handle: key, pub: leaf.PublicKey}
+	if mustFree {
+		runtime.SetFinalizer(k, (*cngKey).free)
+	}
+	return k, nil
+}
+
+var (
+	ncrypt               = windows.NewLazySystemDLL("ncrypt.dll")
+	procNCryptSignHash   = ncrypt.NewProc("NCryptSignHash")
+	procNCryptFreeObject = ncrypt.NewProc("NCryptFreeObject")
+)
+
+const (
+	bcryptPadPKCS1 = 0x2
+	bcryptPadPSS   = 0x8
+)
+
+type bcryptPKCS1PaddingInfo struct {
+	algID *uint16
+}
+
+type bcryptPSSPaddingInfo struct {
+	algID *uint16
+	salt  uint32
+}
+
+// cngKey signs with a CNG key handle. The handle is freed once cngKey is
+// garbage collected, after handshakes using a replaced certificate are done.
+type cngKey struct {
+	handle windows.Handle
+	pub    crypto.PublicKey
+}
+
+func (k *cngKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+func (k *cngKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var (
+		padding unsafe.Pointer
+		flags   uintptr
+	)
+	if _, ok := k.pub.(*rsa.PublicKey); ok {
+		alg, err := cngHashAlg(opts.HashFunc())
+		if err != nil {
+			return nil, err
+		}
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			salt := pss.SaltLength
+			if salt == rsa.PSSSaltLengthEqualsHash || salt == rsa.PSSSaltLengthAuto {
+				salt = opts.HashFunc().Size()
+			}
+			padding, flags = unsafe.Pointer(&bcryptPSSPaddingInfo{alg, uint32(salt)}), bcryptPadPSS
+		} else {
+			padding, flags = unsafe.Pointer(&bcryptPKCS1PaddingInfo{alg}), bcryptPadPKCS1
+		}
+	}
+	sig, err := k.signHash(padding, digest, flags)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := k.pub.(*ecdsa.PublicKey); ok {
+		// CNG returns r || s, while crypto.Signer returns ASN.1 DER.
+		n := len(sig) / 2
+		var b cryptobyte.Builder
+		b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1BigInt(new(big.Int).SetBytes(sig[:n]))
+			b.AddASN1BigInt(new(big.Int).SetBytes(sig[n:]))
+		})
+		return b.Bytes()
+	}
+	return sig, nil
+}
+
+func (k *cngKey) signHash(padding unsafe.Pointer, digest []byte, flags uintptr) ([]byte, error) {
+	var size uint32
+	if r, _, _ := procNCryptSignHash.Call(uintptr(k.handle), uintptr(padding), uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)), 0, 0, uintptr(unsafe.Pointer(&size)), flags); r != 0 {
+		return nil, fmt.Errorf("NCryptSignHash: %w", windows.Errno(r))
+	}
+	sig := make([]byte, size)
+	if r, _, _ := procNCryptSignHash.Call(uintptr(k.handle), uintptr(padding), uintptr(unsafe.Pointer(&digest[0])), uintptr(len(digest)), uintptr(unsafe.Pointer(&sig[0])), uintptr(size), uintptr(unsafe.Pointer(&size)), flags); r != 0 {
+		return nil, fmt.Errorf("NCryptSignHash: %w", windows.Errno(r))
+	}
+	runtime.KeepAlive(k)
+	return sig[:size], nil
+}
+
+func (k *cngKey) free() {
+	procNCryptFreeObject.Call(uintptr(k.handle))
+}
+
+func cngHashAlg(h crypto.Hash) (*uint16, error) {
+	var name string
+	switch h {
+	case crypto.SHA1:
+		name = "SHA1"
+	case crypto.SHA256:
+		name = "SHA256"
+	case crypto.SHA384:
+		name = "SHA384"
+	case crypto.SHA512:
+		name = "SHA512"
+	default:
+		return nil, fmt.Errorf("unsupported hash %v", h)
+	}
+	return windows.UTF16PtrFromString(name)
+}
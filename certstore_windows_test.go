@@ -0,0 +1,82 @@
+package certreloader
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCertStoreString(t *testing.T) {
+	for _, tt := range []struct {
+		store CertStore
+		want  string
+	}{
+		{CertStore{Name: "MY", Thumbprint: "0123"}, `cert:\CurrentUser\MY\0123`},
+		{CertStore{Name: "WebHosting", LocalMachine: true, Subject: "example"}, `cert:\LocalMachine\WebHosting\subject=example`},
+	} {
+		if got := tt.store.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNewFromCertStore(t *testing.T) {
+	absent := make([]byte, 20)
+	if _, err := rand.Read(absent); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		store CertStore
+		err   error
+	}{
+		{"empty", CertStore{}, errInvalidCertStore},
+		{"thumbprint", CertStore{Thumbprint: hex.EncodeToString(absent)}, errCertStoreNotFound},
+		{"subject", CertStore{Subject: "certreloader " + hex.EncodeToString(absent)}, errCertStoreNotFound},
+		{"invalid thumbprint", CertStore{Thumbprint: "zz"}, hex.InvalidByteError('z')},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewFromCertStore(tt.store, time.Hour)
+			if err == nil {
+				r.Stop()
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCertStoreSigner(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := certStoreKey{CertStore{Name: "MY", Thumbprint: "0123"}}
+	if _, err := k.signer(&x509.Certificate{PublicKey: pub}); !errors.Is(err, errUnsupportedKeyType) {
+		t.Errorf("got %v, want %v", err, errUnsupportedKeyType)
+	}
+}
+
+func TestCNGHashAlg(t *testing.T) {
+	for _, tt := range []struct {
+		hash crypto.Hash
+		ok   bool
+	}{
+		{crypto.SHA1, true},
+		{crypto.SHA256, true},
+		{crypto.SHA384, true},
+		{crypto.SHA512, true},
+		{crypto.MD5, false},
+		{crypto.SHA3_256, false},
+	} {
+		if _, err := cngHashAlg(tt.hash); (err == nil) != tt.ok {
+			t.Errorf("%v: got %v, want supported %v", tt.hash, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package certreloader
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+var errChainOrder = errors.New("certificate chain is misordered")
+
+// loadChain reads and concatenates chain files given to WithChainFiles, and
+// computes a digest over them.
+func (r *Reloader) loadChain(ctx context.Context) (chainPEM []byte, dgst uint64, err error) {
+	if len(r.chainSrcs) == 0 {
+		return
+	}
+	for _, src := range r.chainSrcs {
+		data, _, err := r.load(ctx, src)
+		if err != nil {
+			return nil, 0, err
+		}
+		chainPEM = append(append(chainPEM, trimBOM(data)...), '\n')
+	}
+	return chainPEM, r.digest(chainPEM), nil
+}
+
+// checkChainOrder verifies that each certificate of cert is signed by the
+// next one.
+func checkChainOrder(cert *tls.Certificate) error {
+	child := cert.Leaf
+	for i, der := range cert.Certificate[1:] {
+		parent, err := x509.ParseCertificate(der)
+		if err != nil {
+			return err
+		}
+		if err = child.CheckSignatureFrom(parent); err != nil {
+			return fmt.Errorf("%w: certificate %d (%s) is not signed by certificate %d (%s): %v",
+				errChainOrder, i, child.Subject, i+1, parent.Subject, err)
+		}
+		child = parent
+	}
+	return nil
+}
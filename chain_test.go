@@ -0,0 +1,86 @@
+package certreloader
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issueTestCert returns a PEM encoded certificate for cn signed by parent, or
+// self-signed if parent is nil, and its private key.
+func issueTestCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey crypto.Signer) ([]byte, *x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), c, key
+}
+
+func TestChainFiles(t *testing.T) {
+	dir := t.TempDir()
+	_, root, rootKey := issueTestCert(t, "root", true, nil, nil)
+	int1PEM, int1, int1Key := issueTestCert(t, "int1", true, root, rootKey)
+	int2PEM, int2, int2Key := issueTestCert(t, "int2", true, int1, int1Key)
+	leafPEM, _, leafKey := issueTestCert(t, "leaf.example", false, int2, int2Key)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	int1Path := filepath.Join(dir, "int1.pem")
+	int2Path := filepath.Join(dir, "int2.pem")
+	writeTestFile(t, certPath, leafPEM)
+	writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	writeTestFile(t, int1Path, int1PEM)
+	writeTestFile(t, int2Path, int2PEM)
+
+	r, err := New(certPath, keyPath, time.Hour, WithOnError(func(error) {}), WithChainFiles(int2Path, int1Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if chain, _ := r.Chain(); len(chain) != 3 || chain[1].Subject.CommonName != "int2" {
+		t.Errorf("got chain %v", chain)
+	}
+
+	// Swap contents of intermediate files.
+	writeTestFile(t, int1Path, int2PEM)
+	writeTestFile(t, int2Path, int1PEM)
+	if _, err := r.Reload(); !errors.Is(err, errChainOrder) {
+		t.Errorf("got %v, want %v", err, errChainOrder)
+	}
+	if _, err := New(certPath, keyPath, time.Hour, WithChainFiles(int2Path, int1Path)); !errors.Is(err, errChainOrder) {
+		t.Errorf("got %v, want %v", err, errChainOrder)
+	}
+}
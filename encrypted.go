@@ -0,0 +1,219 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+var errUnsupportedKeyEncryption = errors.New("unsupported private key encryption")
+
+// ErrKeyDecrypt is wrapped by reload errors if an encrypted private key cannot
+// be decrypted, usually because of a wrong passphrase. Like other reload
+// failures, the previously loaded certificate keeps being served and the next
+// reload tries again, so that the passphrase file may be updated shortly after
+// the key.
+var ErrKeyDecrypt = errors.New("cannot decrypt private key")
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// encryptedPrivateKeyInfo is defined in RFC 5208.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     algorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params is defined in RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc algorithmIdentifier
+	EncryptionScheme  algorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                 `asn1:"optional"`
+	PRF            algorithmIdentifier `asn1:"optional"`
+}
+
+// decryptKeyPEM returns keyPEM with encrypted private key blocks decrypted by
+// passphrase. Both legacy PEM encryption (RFC 1423) and ENCRYPTED PRIVATE KEY
+// blocks using PBES2 with PBKDF2 and AES-CBC (OpenSSL's default) are
+// supported. Other blocks are kept as is. The former is insecure by design,
+// see x509.DecryptPEMBlock, and only kept for existing keys.
+func decryptKeyPEM(keyPEM, passphrase []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for {
+		var block *pem.Block
+		block, keyPEM = pem.Decode(keyPEM)
+		if block == nil {
+			return out.Bytes(), nil
+		}
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			der, err := decryptPKCS8(block.Bytes, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		case x509.IsEncryptedPEMBlock(block):
+			der, err := x509.DecryptPEMBlock(block, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			// About 1 in 256 wrong passphrases pass the padding check.
+			if parsePrivateKey(der) == nil {
+				zero(der)
+				return nil, x509.IncorrectPasswordError
+			}
+			block = &pem.Block{Type: block.Type, Bytes: der}
+		}
+		if err := pem.Encode(&out, block); err != nil {
+			return nil, err
+		}
+		zero(block.Bytes)
+	}
+}
+
+// decryptPKCS8 decrypts an EncryptedPrivateKeyInfo using PBES2 with PBKDF2 and
+// AES-CBC, and returns the PKCS #8 PrivateKeyInfo. A wrong passphrase is
+// detected by invalid padding or, as padding may be valid by chance, by the
+// result failing to parse.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("%w: %v", errUnsupportedKeyEncryption, info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("%w: %v", errUnsupportedKeyEncryption, params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+	var prf func() hash.Hash
+	switch alg := kdf.PRF.Algorithm; {
+	case len(alg) == 0, alg.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case alg.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case alg.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case alg.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("%w: %v", errUnsupportedKeyEncryption, alg)
+	}
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("%w: %v", errUnsupportedKeyEncryption, alg)
+	}
+	if kdf.KeyLength != 0 && kdf.KeyLength != keyLen {
+		return nil, fmt.Errorf("%w: PBKDF2 key length %d for %v", errUnsupportedKeyEncryption, kdf.KeyLength, params.EncryptionScheme.Algorithm)
+	}
+	if kdf.IterationCount <= 0 {
+		return nil, fmt.Errorf("%w: PBKDF2 iteration count %d", errUnsupportedKeyEncryption, kdf.IterationCount)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, x509.IncorrectPasswordError
+	}
+
+	key, err := pbkdf2.Key(prf, string(passphrase), kdf.Salt, kdf.IterationCount, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+	n := len(plain)
+	if n == 0 {
+		return nil, x509.IncorrectPasswordError
+	}
+	pad := int(plain[n-1])
+	if pad == 0 || pad > aes.BlockSize || pad > n {
+		zero(plain)
+		return nil, x509.IncorrectPasswordError
+	}
+	for _, b := range plain[n-pad:] {
+		if int(b) != pad {
+			zero(plain)
+			return nil, x509.IncorrectPasswordError
+		}
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(plain[:n-pad]); err != nil {
+		zero(plain)
+		return nil, x509.IncorrectPasswordError
+	}
+	return plain[:n-pad], nil
+}
+
+// zero overwrites secret b, best effort.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// decryptKeys decrypts candidate keyPEMs by passphrase read from passphrase
+// file, whose trailing newline is ignored. Unreadable candidates stay nil.
+func decryptKeys(keyPEMs [][]byte, passphrase []byte) ([][]byte, error) {
+	passphrase = bytes.TrimRight(passphrase, "\r\n")
+	out := make([][]byte, len(keyPEMs))
+	for i, keyPEM := range keyPEMs {
+		if keyPEM == nil {
+			continue
+		}
+		var err error
+		if out[i], err = decryptKeyPEM(keyPEM, passphrase); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrKeyDecrypt, err)
+		}
+	}
+	return out, nil
+}
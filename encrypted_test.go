@@ -0,0 +1,160 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Fixtures in testdata/pkcs8 encrypt key.pem by passphrase "secret", generated
+// by `openssl pkcs8 -topk8 -in key.pem -v2 <cipher> [-v2prf <prf>]`. A wrong
+// passphrase yields invalid padding for them.
+
+func TestDecryptPKCS8(t *testing.T) {
+	keyDER := readTestPEM(t, "key.pem")
+	for _, tc := range []struct {
+		file       string
+		passphrase string
+		want       error // nil if decryption succeeds
+	}{
+		{"aes-128-cbc.pem", "secret", nil},
+		{"aes-192-cbc.pem", "secret", nil},
+		{"aes-256-cbc.pem", "secret", nil},
+		{"aes-256-cbc-sha1.pem", "secret", nil},
+		{"aes-256-cbc-sha512.pem", "secret", nil},
+		{"aes-128-cbc.pem", "wrong", x509.IncorrectPasswordError},
+		{"aes-256-cbc.pem", "", x509.IncorrectPasswordError},
+		{"aes-256-cbc-sha224.pem", "secret", errUnsupportedKeyEncryption},
+		{"des3.pem", "secret", errUnsupportedKeyEncryption},
+	} {
+		t.Run(tc.file+"/"+tc.passphrase, func(t *testing.T) {
+			der, err := decryptPKCS8(readTestPEM(t, tc.file), []byte(tc.passphrase))
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+			if tc.want == nil && !bytes.Equal(der, keyDER) {
+				t.Error("decrypted key differs")
+			}
+		})
+	}
+}
+
+func TestDecryptPKCS8KeyLength(t *testing.T) {
+	keyDER := readTestPEM(t, "key.pem")
+	withKeyLength := func(n int) []byte {
+		var info encryptedPrivateKeyInfo
+		if _, err := asn1.Unmarshal(readTestPEM(t, "aes-128-cbc.pem"), &info); err != nil {
+			t.Fatal(err)
+		}
+		var params pbes2Params
+		if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+			t.Fatal(err)
+		}
+		var kdf pbkdf2Params
+		if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+			t.Fatal(err)
+		}
+		kdf.KeyLength = n
+		params.KeyDerivationFunc.Parameters = remarshal(t, kdf)
+		info.Algorithm.Parameters = remarshal(t, params)
+		der, err := asn1.Marshal(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+
+	der, err := decryptPKCS8(withKeyLength(16), []byte("secret"))
+	if err != nil || !bytes.Equal(der, keyDER) {
+		t.Errorf("got %v with matching key length", err)
+	}
+	if _, err = decryptPKCS8(withKeyLength(32), []byte("secret")); !errors.Is(err, errUnsupportedKeyEncryption) {
+		t.Errorf("got %v with key length of AES-256 for AES-128, want %v", err, errUnsupportedKeyEncryption)
+	}
+}
+
+// TestDecryptValidPadding covers a wrong passphrase passing the padding check,
+// simulated by encrypting data other than a private key.
+func TestDecryptValidPadding(t *testing.T) {
+	plain := []byte("not a private key")
+	if _, err := decryptPKCS8(encryptPKCS8(t, plain, []byte("secret")), []byte("secret")); !errors.Is(err, x509.IncorrectPasswordError) {
+		t.Errorf("PBES2: got %v, want %v", err, x509.IncorrectPasswordError)
+	}
+	legacy, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", plain, []byte("secret"), x509.PEMCipherAES128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptKeyPEM(pem.EncodeToMemory(legacy), []byte("secret")); !errors.Is(err, x509.IncorrectPasswordError) {
+		t.Errorf("legacy: got %v, want %v", err, x509.IncorrectPasswordError)
+	}
+}
+
+// encryptPKCS8 returns an EncryptedPrivateKeyInfo of der by passphrase using
+// PBES2 with PBKDF2-HMAC-SHA256 and AES-256-CBC, as OpenSSL does by default.
+func encryptPKCS8(t testing.TB, der, passphrase []byte) []byte {
+	t.Helper()
+	salt, iv := make([]byte, 8), make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, 2048, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(append([]byte(nil), der...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdf := pbkdf2Params{
+		Salt:           salt,
+		IterationCount: 2048,
+		PRF:            algorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	}
+	params := pbes2Params{
+		KeyDerivationFunc: algorithmIdentifier{Algorithm: oidPBKDF2, Parameters: remarshal(t, kdf)},
+		EncryptionScheme:  algorithmIdentifier{Algorithm: oidAES256CBC, Parameters: remarshal(t, iv)},
+	}
+	out, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     algorithmIdentifier{Algorithm: oidPBES2, Parameters: remarshal(t, params)},
+		EncryptedData: data,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// readTestPEM returns the DER of the only PEM block of testdata/pkcs8/name.
+func readTestPEM(t *testing.T, name string) []byte {
+	t.Helper()
+	block, _ := pem.Decode(mustReadTestFile(t, filepath.Join("testdata", "pkcs8", name)))
+	if block == nil {
+		t.Fatalf("%s: no PEM block", name)
+	}
+	return block.Bytes
+}
+
+func remarshal(t testing.TB, v interface{}) asn1.RawValue {
+	t.Helper()
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asn1.RawValue{FullBytes: der}
+}
@@ -0,0 +1,91 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStrictExpiry(t *testing.T) {
+	const grace = time.Hour
+	now := time.Now()
+	r := newTestReloader(t, WithStrictExpiry(grace), WithClock(func() time.Time { return now }))
+	defer r.Stop()
+	roots := x509.NewCertPool()
+	roots.AddCert(r.Leaf())
+	notAfter := r.Leaf().NotAfter
+	for _, tt := range []struct {
+		name string
+		now  time.Time
+		want error // nil if the handshake succeeds
+	}{
+		{"valid", now, nil},
+		{"within grace", notAfter.Add(grace / 2), nil},
+		{"after grace", notAfter.Add(grace + time.Second), errCertExpired},
+	} {
+		now = tt.now
+		if _, err := r.GetCertificate(&tls.ClientHelloInfo{}); err != tt.want {
+			t.Errorf("%s: GetCertificate got %v, want %v", tt.name, err, tt.want)
+		}
+		if _, err := r.GetConfigForClient(&tls.ClientHelloInfo{}); err != tt.want {
+			t.Errorf("%s: GetConfigForClient got %v, want %v", tt.name, err, tt.want)
+		}
+
+		serverConn, clientConn := net.Pipe()
+		server := tls.Server(serverConn, r.TLSConfig())
+		serverErr := make(chan error, 1)
+		go func() {
+			serverErr <- server.Handshake()
+			serverConn.Close()
+		}()
+		client := tls.Client(clientConn, &tls.Config{RootCAs: roots, ServerName: "example"})
+		clientErr := client.Handshake()
+		clientConn.Close()
+		err := <-serverErr
+		if tt.want == nil && (err != nil || clientErr != nil) {
+			t.Errorf("%s: handshake failed: %v, %v", tt.name, err, clientErr)
+		}
+		if tt.want != nil && (!errors.Is(err, tt.want) || clientErr == nil) {
+			t.Errorf("%s: handshake got %v, %v, want rejected by %v", tt.name, err, clientErr, tt.want)
+		}
+	}
+}
+
+func TestExpiredFallback(t *testing.T) {
+	fallback, err := tls.X509KeyPair(newTestPair(t, "fallback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r := newTestReloader(t, WithStrictExpiry(0), WithExpiredFallback(&fallback),
+		WithClock(func() time.Time { return now }))
+	defer r.Stop()
+	loaded := r.Get()
+	for _, tt := range []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{"valid", now, "example"},
+		{"expired", loaded.Leaf.NotAfter.Add(time.Second), "fallback"},
+	} {
+		now = tt.now
+		cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := cert.Leaf.Subject.CommonName; got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+		config, err := r.GetConfigForClient(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := config.Certificates[0].Leaf.Subject.CommonName; got != tt.want {
+			t.Errorf("%s: config serves %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+//go:build unix
+
+package certreloader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NewFromFIFO return a new Reloader for certificate / private key pushed
+// through a named pipe at fifoPath, instead of polling regular files. Each
+// frame is everything written by one writer between opening and closing the
+// pipe, containing certificate chain and private key PEM, e.g.
+// `cat cert.pem key.pem > fifoPath`. A reload is attempted as soon as a frame
+// is complete, and the pipe is reopened for the next writer; writers should
+// not overlap, or their frames may be merged or torn. A malformed
+// frame fails the reload like an unreadable file, keeping the previously
+// loaded certificate. NewFromFIFO blocks until the first frame is received.
+// Periodic reloading every interval only checks the last frame again.
+// WithMaxFileSize limits the size of each frame. With WithManualStart, frames
+// after the first are only received once Start is called. Unlike files, the
+// last frame including its plaintext private key is kept in memory for the
+// life of the Reloader, since it cannot be read again.
+func NewFromFIFO(fifoPath string, interval time.Duration, opts ...Option) (*Reloader, error) {
+	if fifoPath == "" {
+		return nil, errInvalidCertPath
+	}
+	src := &fifoSource{path: fifoPath}
+	opts = append(opts[:len(opts):len(opts)], func(r *Reloader) {
+		r.receiver = func() { r.receive(src) }
+	})
+	return newReloader(src, src, interval, opts)
+}
+
+// fifoSource holds the last frame received from a named pipe. A replaced frame
+// is zeroed, as read only hands out copies.
+type fifoSource struct {
+	path  string
+	mu    sync.Mutex
+	frame []byte
+}
+
+// read returns the last frame, receiving the first one if there is none yet.
+func (s *fifoSource) read(ctx context.Context, limit int64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frame == nil {
+		frame, err := s.next(ctx, limit)
+		if err != nil {
+			return nil, err
+		}
+		s.frame = frame
+	}
+	return append([]byte(nil), s.frame...), nil
+}
+
+func (s *fifoSource) name() string {
+	return s.path
+}
+
+// abs converts the path in place, since s is shared by certificate and
+// private key.
+func (s *fifoSource) abs() (source, error) {
+	p, err := filepath.Abs(s.path)
+	if err != nil {
+		return nil, err
+	}
+	s.path = p
+	return s, nil
+}
+
+// next blocks until a writer opens the pipe, and reads until it closes it.
+func (s *fifoSource) next(ctx context.Context, limit int64) ([]byte, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readAll(ctx, f, limit)
+}
+
+// receive reloads on each frame pushed to src, until r is stopped. Empty
+// frames are ignored.
+func (r *Reloader) receive(src *fifoSource) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		<-r.chStop
+		// Unblock opening of the pipe by opening it for writing, which fails
+		// unless a reader is waiting.
+		for {
+			if f, err := os.OpenFile(src.path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+				f.Close()
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	for {
+		frame, err := src.next(r.ctx, r.maxFileSize)
+		if r.Stopped() {
+			return
+		}
+		if err != nil {
+			r.reportError(reasonReadFailed, err)
+			time.Sleep(time.Second) // avoid spinning on a persistent error
+			continue
+		}
+		if len(frame) == 0 {
+			continue
+		}
+		src.mu.Lock()
+		zero(src.frame)
+		src.frame = frame
+		src.mu.Unlock()
+		r.tick()
+	}
+}
@@ -0,0 +1,114 @@
+//go:build unix
+
+package certreloader
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNewFromFIFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push")
+	if err := unix.Mkfifo(path, 0600); err != nil {
+		t.Skip(err)
+	}
+	push := func(cn string) {
+		certPEM, keyPEM := newTestPair(t, cn)
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		f.Write(certPEM)
+		f.Write(keyPEM)
+		f.Close()
+	}
+	go push("first.example")
+	reloaded := make(chan string, 1)
+	failed := make(chan error, 1)
+	r, err := NewFromFIFO(path, time.Hour, WithOnError(func(err error) { failed <- err }), WithOnReload(func(c *tls.Certificate) {
+		reloaded <- c.Leaf.Subject.CommonName
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if cn := r.Leaf().Subject.CommonName; cn != "first.example" {
+		t.Fatalf("got certificate for %q, want first.example", cn)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("garbage"))
+	f.Close()
+	select {
+	case <-failed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("malformed frame not rejected")
+	}
+	push("second.example")
+	select {
+	case cn := <-reloaded:
+		if cn != "second.example" {
+			t.Errorf("got certificate for %q, want second.example", cn)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("pushed certificate not installed")
+	}
+}
+
+func TestNewFromFIFOManualStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push")
+	if err := unix.Mkfifo(path, 0600); err != nil {
+		t.Skip(err)
+	}
+	push := func(cn string) error {
+		certPEM, keyPEM := newTestPair(t, cn)
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		f.Write(certPEM)
+		f.Write(keyPEM)
+		return f.Close()
+	}
+	go push("first.example")
+	reloaded := make(chan string, 1)
+	r, err := NewFromFIFO(path, time.Hour, WithManualStart(), WithOnReload(func(c *tls.Certificate) {
+		reloaded <- c.Leaf.Subject.CommonName
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// Nobody reads the pipe before Start, so opening it without blocking
+	// fails.
+	time.Sleep(50 * time.Millisecond)
+	if f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+		f.Close()
+		t.Fatal("pipe read before Start")
+	}
+	if err = r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err = push("second.example"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cn := <-reloaded:
+		if cn != "second.example" {
+			t.Errorf("got certificate for %q, want second.example", cn)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("pushed certificate not installed after Start")
+	}
+}
@@ -0,0 +1,58 @@
+package certreloader
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// WithGenerationFile gates reloading on a generation number in the file at
+// path, e.g. written by a controller once all other files are consistent.
+// Certificate / private key are read only when the generation, a decimal
+// integer optionally surrounded by whitespace, is greater than that of the
+// last successful reload. A generation not increased, or a missing or
+// unparsable generation file, skips the reload with Reason "generation not
+// increased", which is logged to the logger of WithDebugLogger but is not
+// an error. The initial load is not gated. Only the generation file is
+// watched if WithFileWatch is given and there is no trigger file.
+func WithGenerationFile(path string) Option {
+	return func(r *Reloader) {
+		r.genSrc = pathSource(path)
+	}
+}
+
+// readGeneration reads the generation file, reporting whether it could be
+// parsed and whether it allows a reload. Failures to read or parse it are
+// logged and disallow the reload, rather than being returned.
+func (r *Reloader) readGeneration(ctx context.Context) (gen int64, valid, ok bool) {
+	data, _, err := r.load(ctx, r.genSrc)
+	if err == nil {
+		gen, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+	valid = err == nil
+	switch {
+	case !valid:
+		r.logGeneration("unusable generation", slog.String("error", err.Error()))
+	case r.genSeen && gen <= r.generation:
+		r.logGeneration("generation not increased", slog.Int64("generation", gen), slog.Int64("installed", r.generation))
+	default:
+		ok = true
+	}
+	return
+}
+
+func (r *Reloader) logGeneration(msg string, attrs ...slog.Attr) {
+	if r.debugLog == nil {
+		return
+	}
+	attrs = append(attrs, slog.String("path", r.genSrc.name()))
+	r.debugLog.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+}
+
+// setGeneration records gen of a successful reload, if valid.
+func (r *Reloader) setGeneration(gen int64, valid bool) {
+	if valid {
+		r.generation, r.genSeen = gen, true
+	}
+}
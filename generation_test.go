@@ -0,0 +1,58 @@
+package certreloader
+
+import (
+	"bytes"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerationFile(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "gen1")
+	genPath := filepath.Join(dir, "generation")
+	writeTestFile(t, genPath, []byte("1\n"))
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	r, err := New(certPath, keyPath, time.Hour, WithGenerationFile(genPath), WithDebugLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	for _, tc := range []struct {
+		cn, gen string
+		want    string // served after reload
+		reason  string
+		log     string
+	}{
+		{"gen2", "1", "gen1", reasonGeneration, "generation not increased"},
+		{"gen2", "2", "gen2", reasonInstalled, ""},
+		{"gen3", "garbage", "gen2", reasonGeneration, "unusable generation"},
+		{"gen3", "1", "gen2", reasonGeneration, "generation not increased"},
+		{"gen3", " 10 ", "gen3", reasonInstalled, ""},
+	} {
+		logs.Reset()
+		writeTestPair(t, dir, tc.cn)
+		writeTestFile(t, genPath, []byte(tc.gen))
+		res, err := r.Reload()
+		if err != nil || res.Reason != tc.reason {
+			t.Fatalf("generation %q: got %+v, %v, want reason %q", tc.gen, res, err, tc.reason)
+		}
+		if cn := r.Leaf().Subject.CommonName; cn != tc.want {
+			t.Errorf("generation %q: serving %q, want %q", tc.gen, cn, tc.want)
+		}
+		if tc.log != "" && !strings.Contains(logs.String(), tc.log) {
+			t.Errorf("generation %q: missing %q in debug log %q", tc.gen, tc.log, logs.String())
+		}
+	}
+
+	// Unchanged generation is accepted again once forgotten.
+	writeTestPair(t, dir, "forced")
+	r.ResetCache()
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Errorf("got %+v, %v after ResetCache", res, err)
+	}
+}
@@ -0,0 +1,110 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkConsistent fails unless cert is a fully populated pair.
+func checkConsistent(t testing.TB, cert *tls.Certificate) {
+	if cert == nil || cert.Leaf == nil || len(cert.Certificate) == 0 {
+		t.Fatalf("got partially populated certificate %+v", cert)
+	}
+	if !bytes.Equal(cert.Leaf.Raw, cert.Certificate[0]) {
+		t.Fatal("Leaf does not match Certificate[0]")
+	}
+	pub := cert.PrivateKey.(crypto.Signer).Public()
+	if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(cert.Leaf.PublicKey) {
+		t.Fatal("PrivateKey does not match Leaf")
+	}
+}
+
+// reloadForever alternates certificate / private key between pairs and
+// reloads, until stop is closed.
+func reloadForever(t testing.TB, r *Reloader, stop <-chan struct{}) {
+	var pairs [2][2][]byte
+	for i := range pairs {
+		pairs[i][0], pairs[i][1] = newTestPair(t, "example")
+	}
+	for i := 0; ; i++ {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		pair := pairs[i%2]
+		if err := ioutil.WriteFile(r.CertPath(), pair[0], 0600); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := ioutil.WriteFile(r.KeyPath(), pair[1], 0600); err != nil {
+			t.Error(err)
+			return
+		}
+		r.Reload()
+	}
+}
+
+func TestGetDuringReload(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reloadForever(t, r, stop)
+	}()
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		checkConsistent(t, r.Get())
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestGetAllocs(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	if n := testing.AllocsPerRun(100, func() { r.Get() }); n != 0 {
+		t.Errorf("Get allocates %v times", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { r.NotAfterUnix() }); n != 0 {
+		t.Errorf("NotAfterUnix allocates %v times", n)
+	}
+	if got, want := r.NotAfterUnix(), r.Leaf().NotAfter.Unix(); got != want {
+		t.Errorf("NotAfterUnix returns %d, want %d", got, want)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	r := newTestReloader(b)
+	defer r.Stop()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.Get()
+		}
+	})
+}
+
+func BenchmarkGetDuringReload(b *testing.B) {
+	r := newTestReloader(b)
+	defer r.Stop()
+	stop := make(chan struct{})
+	defer close(stop)
+	go reloadForever(b, r, stop)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.Get()
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package certreloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidPattern = errors.New("invalid glob pattern")
+	errNoMatch        = errors.New("no file matches")
+)
+
+// NewFromGlob return a new Reloader for certificate / private key whose file
+// names change on rotation, e.g. timestamped ones, instead of having a stable
+// path or symlink. On each reload, the file matching certPattern / keyPattern
+// (see filepath.Match) with the newest modification time is used, or the
+// lexically last one of those modified at the same time; directories are
+// never matched. A reload fails if no file matches, keeping the previously
+// loaded certificate, and if the newest certificate and private key do not
+// match, e.g. while a new pair is being written, until a later reload picks
+// up both. File watching is supported if the directory part of patterns is
+// literal. Otherwise it works like New.
+func NewFromGlob(certPattern, keyPattern string, interval time.Duration, opts ...Option) (*Reloader, error) {
+	for _, pattern := range []string{certPattern, keyPattern} {
+		if _, err := filepath.Match(pattern, ""); pattern == "" || err != nil {
+			return nil, errInvalidPattern
+		}
+	}
+	return newReloader(globSource(certPattern), globSource(keyPattern), interval, opts)
+}
+
+// hasGlobMeta reports whether path contains special characters of
+// filepath.Match.
+func hasGlobMeta(path string) bool {
+	meta := `*?[`
+	if runtime.GOOS != "windows" {
+		meta += `\` // escapes, except where it is the path separator
+	}
+	return strings.ContainsAny(path, meta)
+}
+
+// globSource reads the newest file matching a pattern on each reload.
+type globSource string
+
+// newest returns the path and metadata of the newest regular file matching
+// pattern, breaking ties by the lexically last path.
+func newest(pattern string) (string, os.FileInfo, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", nil, err
+	}
+	var (
+		path string
+		fi   os.FileInfo
+	)
+	for _, m := range matches { // sorted by filepath.Glob
+		mfi, err := os.Stat(m)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // removed meanwhile
+			}
+			return "", nil, err
+		}
+		if !mfi.Mode().IsRegular() {
+			continue
+		}
+		if fi == nil || !mfi.ModTime().Before(fi.ModTime()) {
+			path, fi = m, mfi
+		}
+	}
+	if fi == nil {
+		return "", nil, fmt.Errorf("%w %s", errNoMatch, pattern)
+	}
+	return path, fi, nil
+}
+
+func (s globSource) read(ctx context.Context, limit int64) ([]byte, error) {
+	path, _, err := newest(string(s))
+	if err != nil {
+		return nil, err
+	}
+	return pathSource(path).read(ctx, limit)
+}
+
+func (s globSource) name() string {
+	return string(s)
+}
+
+// stamp is that of the newest file, which differs once another file becomes
+// the newest one, since inode numbers are included where available.
+func (s globSource) stamp() (fileStamp, error) {
+	_, fi, err := newest(string(s))
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return newFileStamp(fi), nil
+}
+
+func (s globSource) abs() (source, error) {
+	abs, err := filepath.Abs(string(s))
+	if err != nil {
+		return nil, err
+	}
+	return globSource(abs), nil
+}
@@ -0,0 +1,81 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewest(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for _, f := range []struct {
+		name string
+		age  time.Duration
+	}{
+		{"cert-1.pem", 2 * time.Hour},
+		{"cert-2.pem", time.Hour},
+		{"cert-3.pem", time.Hour},
+		{"cert-0.pem", 3 * time.Hour},
+		{"other.pem", 0},
+	} {
+		path := filepath.Join(dir, f.name)
+		writeTestFile(t, path, nil)
+		if err := os.Chtimes(path, now, now.Add(-f.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "cert-9.pem"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path, _, err := newest(filepath.Join(dir, "cert-*.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "cert-3.pem"); path != want {
+		t.Errorf("got %s, want %s", path, want)
+	}
+	if _, _, err := newest(filepath.Join(dir, "key-*.pem")); !errors.Is(err, errNoMatch) {
+		t.Errorf("got %v, want %v", err, errNoMatch)
+	}
+}
+
+func TestNewFromGlob(t *testing.T) {
+	dir := t.TempDir()
+	writePair := func(suffix string, mtime time.Time) {
+		certPEM, keyPEM := newTestPair(t, "example")
+		for name, data := range map[string][]byte{"cert-" + suffix: certPEM, "key-" + suffix: keyPEM} {
+			path := filepath.Join(dir, name)
+			writeTestFile(t, path, data)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	now := time.Now()
+	writePair("1.pem", now.Add(-time.Hour))
+	reloaded := make(chan *tls.Certificate, 1)
+	r, err := NewFromGlob(filepath.Join(dir, "cert-*.pem"), filepath.Join(dir, "key-*.pem"), time.Hour,
+		WithFileWatch(10*time.Millisecond), WithOnReload(func(cert *tls.Certificate) { reloaded <- cert }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	old := r.Get()
+
+	writePair("2.pem", now)
+	select {
+	case cert := <-reloaded:
+		if cert == old {
+			t.Error("old certificate reloaded")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("newer files not picked up")
+	}
+	if res, err := r.Reload(); err != nil || res.Changed {
+		t.Errorf("got %+v, %v, want no change", res, err)
+	}
+}
@@ -1,9 +1,15 @@
 module github.com/zhangyoufu/certreloader
 
-go 1.12
+go 1.24.0
 
 require (
-	github.com/OneOfOne/xxhash v1.2.5 // indirect
 	github.com/cespare/xxhash v1.1.0
+	github.com/fsnotify/fsnotify v1.10.1
+	golang.org/x/crypto v0.48.0
+	golang.org/x/sys v0.41.0
+)
+
+require (
+	github.com/OneOfOne/xxhash v1.2.5 // indirect
 	github.com/spaolacci/murmur3 v1.1.0 // indirect
 )
@@ -0,0 +1,20 @@
+module github.com/zhangyoufu/certreloader/grpccred
+
+go 1.26.0
+
+require (
+	github.com/zhangyoufu/certreloader v0.0.0-20261014172924-2b9ce09d55af
+	google.golang.org/grpc v1.84.0
+)
+
+require (
+	github.com/cespare/xxhash v1.1.0 // indirect
+	github.com/fsnotify/fsnotify v1.10.1 // indirect
+	golang.org/x/crypto v0.57.0 // indirect
+	golang.org/x/sys v0.48.0 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+)
+
+// Build against the enclosing checkout during development. Consumers ignore
+// this and resolve the version required above.
+replace github.com/zhangyoufu/certreloader => ../
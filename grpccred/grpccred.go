@@ -0,0 +1,29 @@
+// Package grpccred adapts a certreloader.Reloader to grpc-go transport
+// credentials. It lives in a separate module, so that certreloader itself does
+// not depend on grpc-go.
+package grpccred
+
+import (
+	"crypto/tls"
+
+	"github.com/zhangyoufu/certreloader"
+	"google.golang.org/grpc/credentials"
+)
+
+// ServerCredentials returns server side transport credentials serving the
+// certificate currently loaded by r. Rotations are reflected automatically,
+// since the certificate is looked up on each handshake. Other parameters are
+// taken from base, which may be nil and is not modified. It is a function
+// rather than a GRPCServerCredentials method of Reloader, since methods cannot
+// be declared outside the package of their type.
+func ServerCredentials(r *certreloader.Reloader, base *tls.Config) credentials.TransportCredentials {
+	var config *tls.Config
+	if base != nil {
+		config = base.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	config.Certificates = nil
+	config.GetCertificate = r.GetCertificate
+	return credentials.NewTLS(config)
+}
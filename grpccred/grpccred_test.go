@@ -0,0 +1,113 @@
+package grpccred
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zhangyoufu/certreloader"
+	"google.golang.org/grpc/credentials"
+)
+
+// writeTestPair writes a self-signed certificate for "example" and its private
+// key into dir, and returns the certificate.
+func writeTestPair(t *testing.T, dir string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "example"},
+		DNSNames:     []string{"example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// handshake performs a TLS handshake between creds and a client trusting
+// root, and returns the certificate presented by creds.
+func handshake(t *testing.T, creds credentials.TransportCredentials, root *x509.Certificate) *x509.Certificate {
+	t.Helper()
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	client := credentials.NewTLS(&tls.Config{RootCAs: roots})
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := creds.ServerHandshake(serverConn)
+		errs <- err
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, info, err := client.ClientHandshake(ctx, "example:443", clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+	return info.(credentials.TLSInfo).State.PeerCertificates[0]
+}
+
+func TestServerCredentials(t *testing.T) {
+	dir := t.TempDir()
+	old := writeTestPair(t, dir)
+	r, err := certreloader.New(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	base := &tls.Config{MinVersion: tls.VersionTLS13}
+	creds := ServerCredentials(r, base)
+	if base.GetCertificate != nil {
+		t.Error("base modified")
+	}
+	if got := handshake(t, creds, old); !got.Equal(old) {
+		t.Fatalf("presented %s, want %s", got.Subject, old.Subject)
+	}
+
+	// Rotations are picked up by the same credentials.
+	rotated := writeTestPair(t, dir)
+	if _, err = r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := handshake(t, creds, rotated); !got.Equal(rotated) {
+		t.Errorf("presented %s after rotation, want the rotated certificate", got.Subject)
+	}
+}
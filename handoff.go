@@ -0,0 +1,107 @@
+package certreloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errNoState          = errors.New("no certificate loaded")
+	errStateVersion     = errors.New("unsupported state version")
+	errStateUnsupported = errors.New("state snapshot requires a Reloader created by New or NewCertOnly")
+
+	// ErrStateMismatch is wrapped by the error of RestoreFromPaths if the
+	// certificate loaded from the paths of the state differs from the one
+	// served by the predecessor, e.g. because it was rotated meanwhile.
+	ErrStateMismatch = errors.New("loaded certificate differs from state")
+)
+
+// stateVersion is the version of the format of StateSnapshot.
+const stateVersion = 1
+
+// handoffState is the serialized form of StateSnapshot.
+type handoffState struct {
+	Version     int      `json:"version"`
+	CertPath    string   `json:"cert_path"`
+	KeyPath     string   `json:"key_path,omitempty"`
+	Chain       [][]byte `json:"chain"`              // DER, leaf first
+	Fingerprint string   `json:"fingerprint_sha256"` // of the leaf
+}
+
+// StateSnapshot serializes what is needed by a successor process to take over
+// serving the currently loaded certificate, e.g. during a zero-downtime
+// upgrade by socket handoff: the resolved certificate / private key paths,
+// the certificate chain and the SHA-256 fingerprint of the leaf, but not the
+// private key, which the successor reads from disk again. Pass the result to
+// RestoreFromPaths. The format is JSON and may gain fields in the future.
+// Only a Reloader created by New or NewCertOnly can be snapshotted.
+func (r *Reloader) StateSnapshot() ([]byte, error) {
+	r.pathMu.RLock()
+	certSrc, keySrc := r.certSrc, r.keySrc
+	r.pathMu.RUnlock()
+	_, certIsPath := certSrc.(pathSource)
+	_, keyIsPath := keySrc.(pathSource)
+	if !certIsPath || !keyIsPath && !r.certOnly || r.bundle || r.pkcs7 {
+		return nil, errStateUnsupported
+	}
+	cert := r.current()
+	if cert == nil {
+		return nil, errNoState
+	}
+	state := handoffState{
+		Version:     stateVersion,
+		CertPath:    certSrc.name(),
+		Chain:       cert.Certificate,
+		Fingerprint: fingerprint(cert.Leaf),
+	}
+	if !r.certOnly {
+		state.KeyPath = keySrc.name()
+	}
+	return json.Marshal(&state)
+}
+
+// RestoreFromPaths returns a new Reloader for the paths of state, as returned
+// by StateSnapshot of a predecessor process, created by New or NewCertOnly
+// with interval and opts. It verifies that the certificate loaded from those
+// paths is the one served by the predecessor. If not, the Reloader is
+// returned nonetheless, along with an error wrapping ErrStateMismatch, so
+// that the caller can decide whether serving the newer certificate is fine.
+// Relative paths of WithRelativePaths are resolved against the working
+// directory of the successor.
+func RestoreFromPaths(state []byte, interval time.Duration, opts ...Option) (*Reloader, error) {
+	var s handoffState
+	if err := json.Unmarshal(state, &s); err != nil {
+		return nil, fmt.Errorf("invalid state: %w", err)
+	}
+	if s.Version != stateVersion {
+		return nil, fmt.Errorf("%w %d", errStateVersion, s.Version)
+	}
+	var (
+		r   *Reloader
+		err error
+	)
+	if s.KeyPath == "" {
+		r, err = NewCertOnly(s.CertPath, interval, opts...)
+	} else {
+		r, err = New(s.CertPath, s.KeyPath, interval, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	chain := r.current().Certificate
+	if fp := fingerprint(r.Leaf()); fp != s.Fingerprint {
+		return r, fmt.Errorf("%w: leaf %s, want %s", ErrStateMismatch, fp, s.Fingerprint)
+	}
+	if len(chain) != len(s.Chain) {
+		return r, fmt.Errorf("%w: chain of %d certificates, want %d", ErrStateMismatch, len(chain), len(s.Chain))
+	}
+	for i := range chain {
+		if !bytes.Equal(chain[i], s.Chain[i]) {
+			return r, fmt.Errorf("%w: certificate %d of chain", ErrStateMismatch, i)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,68 @@
+package certreloader
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStateSnapshot(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	state, err := r.StateSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(mustReadTestFile(t, r.KeyPath()))
+	if bytes.Contains(state, []byte(base64.StdEncoding.EncodeToString(block.Bytes))) {
+		t.Fatal("private key exported")
+	}
+
+	successor, err := RestoreFromPaths(state, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer successor.Stop()
+	if successor.CertPath() != r.CertPath() || successor.KeyPath() != r.KeyPath() ||
+		fingerprint(successor.Leaf()) != fingerprint(r.Leaf()) {
+		t.Error("successor serves another certificate")
+	}
+	checkConsistent(t, successor.Get())
+
+	// Rotated in between.
+	certPEM, keyPEM := newTestPair(t, "rotated")
+	writeTestFile(t, r.CertPath(), certPEM)
+	writeTestFile(t, r.KeyPath(), keyPEM)
+	rotated, err := RestoreFromPaths(state, time.Hour)
+	if !errors.Is(err, ErrStateMismatch) || rotated == nil {
+		t.Fatalf("got %v, want %v", err, ErrStateMismatch)
+	}
+	defer rotated.Stop()
+	if rotated.Leaf().Subject.CommonName != "rotated" {
+		t.Error("rotated certificate not loaded")
+	}
+
+	certOnly, err := NewCertOnly(r.CertPath(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer certOnly.Stop()
+	if state, err = certOnly.StateSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := RestoreFromPaths(state, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Stop()
+	if restored.Get() != nil || restored.KeyPath() != "" {
+		t.Error("restored certificate-only Reloader has a key")
+	}
+
+	if _, err = RestoreFromPaths([]byte(`{"version":2}`), time.Hour); !errors.Is(err, errStateVersion) {
+		t.Errorf("got %v, want %v", err, errStateVersion)
+	}
+}
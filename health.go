@@ -0,0 +1,51 @@
+package certreloader
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultStaleFactor is the number of reload intervals without a successful
+// reload before Healthy reports the reloader as stale.
+const defaultStaleFactor = 3
+
+// Healthy reports whether the reloader is serving a usable certificate. It
+// returns false and a reason when no certificate is loaded, the loaded
+// certificate is expired, or the last successful reload is older than the
+// stale threshold (3 reload intervals unless changed by WithStaleAfter), which
+// indicates that reloading is stuck or keeps failing.
+func (r *Reloader) Healthy() (bool, string) {
+	cert := r.current()
+	if cert == nil {
+		return false, "no certificate loaded"
+	}
+	now := r.now()
+	if now.After(cert.Leaf.NotAfter) {
+		return false, "certificate expired at " + cert.Leaf.NotAfter.Format(time.RFC3339)
+	}
+	if last := r.lastSuccess(); now.Sub(last) > r.staleAfter {
+		return false, "no successful reload since " + last.Format(time.RFC3339)
+	}
+	return true, ""
+}
+
+var errNotRotated = errors.New("certificate not rotated, renewal may be broken")
+
+// checkRotation returns a warning if no new certificate was installed for
+// longer than the threshold of WithRotationWarning, by the clock of WithClock.
+func (r *Reloader) checkRotation() []error {
+	last, _ := r.lastSwap.Load().(time.Time)
+	if last.IsZero() {
+		return nil
+	}
+	if age := r.now().Sub(last); age > r.rotationWarn {
+		return []error{fmt.Errorf("%s: %w since %s (%v)", r.CertPath(), errNotRotated, last.Format(time.RFC3339), age.Round(time.Second))}
+	}
+	return nil
+}
+
+func (r *Reloader) lastSuccess() time.Time {
+	t, _ := r.lastOK.Load().(time.Time)
+	return t
+}
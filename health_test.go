@@ -0,0 +1,22 @@
+package certreloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReloadGuardHealthy(t *testing.T) {
+	now := time.Now()
+	r := newTestReloader(t, WithClock(func() time.Time { return now }), WithStaleAfter(time.Minute),
+		WithReloadGuard(func() bool { return false }))
+	defer r.Stop()
+	action := r.LastAction()
+	now = now.Add(2 * time.Minute)
+	r.tick()
+	if ok, reason := r.Healthy(); !ok {
+		t.Errorf("got unhealthy %q with reloads guarded", reason)
+	}
+	if got := r.LastAction(); got != action {
+		t.Errorf("guarded tick changed last action from %q to %q", action, got)
+	}
+}
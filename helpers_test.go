@@ -0,0 +1,117 @@
+package certreloader
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestPair returns a PEM encoded self-signed certificate for cn and its
+// private key.
+func newTestPair(t testing.TB, cn string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+// writeTestPair writes certificate / private key for cn into dir, and returns
+// their paths.
+func writeTestPair(t testing.TB, dir, cn string) (certPath, keyPath string) {
+	t.Helper()
+	certPEM, keyPEM := newTestPair(t, cn)
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+	writeTestFile(t, certPath, certPEM)
+	writeTestFile(t, keyPath, keyPEM)
+	return
+}
+
+// newTestReloader returns a Reloader for a new pair, which is not reloaded in
+// background during tests.
+func newTestReloader(t testing.TB, opts ...Option) *Reloader {
+	t.Helper()
+	certPath, keyPath := writeTestPair(t, t.TempDir(), "example")
+	r, err := New(certPath, keyPath, time.Hour, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// withReadFile replaces reading of certificate / private key paths by fn, for
+// injecting faults.
+func withReadFile(fn func(string) ([]byte, error)) Option {
+	return func(r *Reloader) {
+		r.readFile = fn
+	}
+}
+
+// withRacyWindow replaces racyStampWindow, so that stamps of files just
+// written are trusted without waiting for them to settle.
+func withRacyWindow(d time.Duration) Option {
+	return func(r *Reloader) {
+		r.racyWindow = d
+	}
+}
+
+func writeTestFile(t testing.TB, path string, data []byte) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// replaceTestFile atomically replaces path with data by renaming.
+func replaceTestFile(t testing.TB, path string, data []byte) {
+	t.Helper()
+	tmp := path + ".tmp"
+	writeTestFile(t, tmp, data)
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func mustReadTestFile(t testing.TB, path string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,47 @@
+package certreloader
+
+import (
+	"sync"
+)
+
+// defaultHistorySize is the number of reloads kept by History by default.
+const defaultHistorySize = 16
+
+// history is a ring buffer of recent reloads.
+type history struct {
+	mu   sync.Mutex
+	buf  []ReloadInfo
+	next int // where the next record goes
+	full bool
+}
+
+func (h *history) add(info ReloadInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf[h.next] = info
+	h.next++
+	if h.next == len(h.buf) {
+		h.next, h.full = 0, true
+	}
+}
+
+// records returns a copy of recorded reloads, oldest first.
+func (h *history) records() []ReloadInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]ReloadInfo(nil), h.buf[:h.next]...)
+	}
+	return append(append([]ReloadInfo(nil), h.buf[h.next:]...), h.buf[:h.next]...)
+}
+
+// History returns the most recent reload attempts, oldest first, including
+// the initial load, for postmortems or a debug endpoint. At most 16 are kept,
+// unless changed by WithHistorySize. It returns nil if history is disabled.
+// It is safe to call concurrently with reloads.
+func (r *Reloader) History() []ReloadInfo {
+	if r.history == nil {
+		return nil
+	}
+	return r.history.records()
+}
@@ -0,0 +1,57 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+// NewServer returns srv, or a new http.Server if srv is nil, serving
+// currently loaded certificate through GetCertificate, along with a TLS
+// listener on addr, ready for srv.Serve. Its TLSConfig is a clone of that of
+// srv, with GetCertificate replaced and NextProtos defaulting to HTTP/2 and
+// HTTP/1.1, so that other settings carry over. Unless set, GetConfigForClient
+// hands handshakes requiring client CAs of WithClientCAFile, or certificates
+// of SetALPNCertificate and SetServerNameConfig, to GetConfigForClient of r,
+// whose configs derive from WithBaseConfig or WithTLSPreset instead. Addr and
+// TLSConfig of srv are only set once listening on addr succeeds. It fails in
+// certificate-only mode.
+func (r *Reloader) NewServer(addr string, srv *http.Server) (*http.Server, net.Listener, error) {
+	if r.certOnly {
+		return nil, nil, errCertOnly
+	}
+	if srv == nil {
+		srv = &http.Server{}
+	}
+	config := srv.TLSConfig.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config.GetCertificate = r.GetCertificate
+	if config.GetConfigForClient == nil {
+		config.GetConfigForClient = r.serverConfigForClient
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	srv.Addr = addr
+	srv.TLSConfig = config
+	return srv, tls.NewListener(ln, config), nil
+}
+
+// serverConfigForClient is GetConfigForClient of servers by NewServer. It
+// returns nil, keeping the config of the server, unless chi needs one of r.
+func (r *Reloader) serverConfigForClient(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+	if r.caSrc == nil {
+		if _, cert := r.alpnCertificate(chi); cert == nil {
+			if _, ok := r.nameOverride(chi); !ok {
+				return nil, nil
+			}
+		}
+	}
+	return r.GetConfigForClient(chi)
+}
@@ -0,0 +1,100 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestNewServer(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	srv, ln, err := r.NewServer("127.0.0.1:0", &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(req.Proto))
+		}),
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS13},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+	if srv.TLSConfig.MinVersion != tls.VersionTLS13 {
+		t.Error("TLSConfig of server not carried over")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(r.Leaf())
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: "example"},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("got %s, want HTTP/2.0", body)
+	}
+}
+
+func TestNewServerListenError(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	config := &tls.Config{MinVersion: tls.VersionTLS13}
+	srv := &http.Server{Addr: "old", TLSConfig: config}
+	if _, _, err := r.NewServer("invalid address", srv); err == nil {
+		t.Fatal("listened on invalid address")
+	}
+	if srv.Addr != "old" || srv.TLSConfig != config || config.GetCertificate != nil {
+		t.Error("server modified by failed listen")
+	}
+}
+
+func TestNewServerNameOverride(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	certPEM, keyPEM := newTestPair(t, "other")
+	other, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Leaf, err = x509.ParseCertificate(other.Certificate[0]); err != nil {
+		t.Fatal(err)
+	}
+	r.SetServerNameConfig("other", &other, func(config *tls.Config) {
+		config.MaxVersion = tls.VersionTLS12
+	})
+	srv, ln, err := r.NewServer("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		serverName string
+		leaf       *x509.Certificate
+		version    uint16
+	}{
+		{"example", r.Leaf(), tls.VersionTLS13},
+		{"other", other.Leaf, tls.VersionTLS12},
+	} {
+		roots := x509.NewCertPool()
+		roots.AddCert(tc.leaf)
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: roots, ServerName: tc.serverName})
+		if err != nil {
+			t.Errorf("%s: %v", tc.serverName, err)
+			continue
+		}
+		if v := conn.ConnectionState().Version; v != tc.version {
+			t.Errorf("%s: negotiated version %x, want %x", tc.serverName, v, tc.version)
+		}
+		conn.Close()
+	}
+}
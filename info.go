@@ -0,0 +1,227 @@
+package certreloader
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Leaf returns the parsed leaf of currently loaded certificate, or nil if none
+// is loaded.
+func (r *Reloader) Leaf() *x509.Certificate {
+	cert := r.current()
+	if cert == nil {
+		return nil
+	}
+	return cert.Leaf
+}
+
+// NotAfterUnix returns the expiry of currently loaded leaf certificate as a
+// Unix timestamp, or 0 if none is loaded. It is lock-free and does not
+// allocate, and exposes nothing that could be modified, e.g. for updating a
+// gauge frequently.
+func (r *Reloader) NotAfterUnix() int64 {
+	if snap := r.snapshot(); snap != nil {
+		return snap.notAfter
+	}
+	return 0
+}
+
+// TimeToExpiry returns how long currently loaded leaf certificate remains
+// valid according to the clock set by WithClock, which is negative once it
+// expired, e.g. for a probe alerting below a threshold. It returns 0 if none
+// is loaded, which never happens after successful construction.
+func (r *Reloader) TimeToExpiry() time.Duration {
+	leaf := r.Leaf()
+	if leaf == nil {
+		return 0
+	}
+	return leaf.NotAfter.Sub(r.now())
+}
+
+// KeyType describes the public key of currently loaded leaf certificate by
+// algorithm and size, i.e. "RSA 2048", "ECDSA P-256" or "Ed25519", e.g. for
+// an inventory of deployed key types. It returns an empty string if none is
+// loaded.
+func (r *Reloader) KeyType() string {
+	leaf := r.Leaf()
+	if leaf == nil {
+		return ""
+	}
+	return keyType(leaf.PublicKey)
+}
+
+// Status describes the currently loaded certificate, e.g. for a fleet-wide
+// inventory or a status page. All fields are taken from the same certificate.
+type Status struct {
+	// Subject is the subject of the leaf certificate.
+	Subject string
+	// DNSNames are the DNS names in its SAN extension.
+	DNSNames []string
+	// NotAfter is when it expires.
+	NotAfter time.Time
+	// KeyType describes its public key like Reloader.KeyType.
+	KeyType string
+	// Fingerprint is its fingerprint in hex, by SHA-256 unless changed by
+	// WithFingerprintHash.
+	Fingerprint string
+	// Installed is when it was installed, by a reload or Pin.
+	Installed time.Time
+}
+
+// Status returns a snapshot of the currently loaded certificate, or zero Status
+// if none is loaded.
+func (r *Reloader) Status() Status {
+	leaf := r.Leaf()
+	if leaf == nil {
+		return Status{}
+	}
+	installed, _ := r.lastSwap.Load().(time.Time)
+	return Status{
+		Subject:     leaf.Subject.String(),
+		DNSNames:    append([]string(nil), leaf.DNSNames...),
+		NotAfter:    leaf.NotAfter,
+		KeyType:     keyType(leaf.PublicKey),
+		Fingerprint: r.fingerprint(leaf),
+		Installed:   installed,
+	}
+}
+
+func keyType(pub crypto.PublicKey) string {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + pub.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
+
+// DNSNames returns DNS names in the SAN extension of currently loaded leaf
+// certificate, e.g. to confirm that it covers the server names requested by
+// clients. It returns nil if none is loaded. The result is a copy.
+func (r *Reloader) DNSNames() []string {
+	leaf := r.Leaf()
+	if leaf == nil {
+		return nil
+	}
+	return append([]string(nil), leaf.DNSNames...)
+}
+
+// IPAddresses returns IP addresses in the SAN extension of currently loaded
+// leaf certificate, or nil if none is loaded. The result is a deep copy.
+func (r *Reloader) IPAddresses() []net.IP {
+	leaf := r.Leaf()
+	if leaf == nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, ip := range leaf.IPAddresses {
+		ips = append(ips, append(net.IP(nil), ip...))
+	}
+	return ips
+}
+
+// Supports reports whether the loaded certificate, selected for chi as by
+// GetCertificate in case of NewFromBundle or WithAdditionalPair, satisfies
+// chi, returning the error of tls.ClientHelloInfo.SupportsCertificate
+// verbatim, e.g. to diagnose a mismatch of server name or signature schemes.
+// Certificates registered by SetALPNCertificate or SetServerNameConfig are not
+// considered. It fails in certificate-only mode.
+func (r *Reloader) Supports(chi *tls.ClientHelloInfo) error {
+	if r.certOnly {
+		return errCertOnly
+	}
+	_, cert := r.selectPair(chi)
+	return chi.SupportsCertificate(cert)
+}
+
+// Chain parses and returns currently loaded certificate chain, starting with
+// the leaf.
+func (r *Reloader) Chain() ([]*x509.Certificate, error) {
+	cert := r.current()
+	if cert == nil {
+		return nil, nil
+	}
+	chain := make([]*x509.Certificate, 0, len(cert.Certificate))
+	chain = append(chain, cert.Leaf)
+	for _, der := range cert.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, c)
+	}
+	return chain, nil
+}
+
+// CertPEM returns currently loaded certificate chain re-encoded as PEM, as it
+// is being served regardless of later changes of files, e.g. for a support
+// bundle. It never includes the private key. It returns nil if nothing is
+// loaded.
+func (r *Reloader) CertPEM() []byte {
+	cert := r.current()
+	if cert == nil {
+		return nil
+	}
+	var buf []byte
+	for _, der := range cert.Certificate {
+		buf = append(buf, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return buf
+}
+
+// fingerprint returns hex encoded SHA-256 digest of DER encoded c.
+func fingerprint(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// fingerprint returns hex encoded digest of DER encoded c by the hash given
+// to WithFingerprintHash.
+func (r *Reloader) fingerprint(c *x509.Certificate) string {
+	if r.fpHash == 0 {
+		return fingerprint(c)
+	}
+	h := r.fpHash.New()
+	h.Write(c.Raw)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintLabel names the hash of r.fingerprint, e.g. "sha256".
+func (r *Reloader) fingerprintLabel() string {
+	if r.fpHash == 0 {
+		return "sha256"
+	}
+	return strings.ToLower(strings.ReplaceAll(r.fpHash.String(), "-", ""))
+}
+
+// summary describes c in a single line without any private key material.
+func summary(c *x509.Certificate) string {
+	var sans []string
+	sans = append(sans, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, c.EmailAddresses...)
+	for _, uri := range c.URIs {
+		sans = append(sans, uri.String())
+	}
+	return fmt.Sprintf("subject=%q sans=[%s] issuer=%q serial=%s key=%q not_before=%s not_after=%s sha256=%s",
+		c.Subject, strings.Join(sans, ","), c.Issuer, c.SerialNumber.Text(16), keyType(c.PublicKey),
+		c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339),
+		fingerprint(c))
+}
@@ -0,0 +1,248 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertPEM(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	want := mustReadTestFile(t, r.CertPath())
+	writeTestFile(t, r.CertPath(), []byte("changed"))
+	got := r.CertPEM()
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, hasKey := pemTypes(got); hasKey {
+		t.Error("private key exported")
+	}
+}
+
+func TestTimeToExpiry(t *testing.T) {
+	now := time.Now()
+	r := newTestReloader(t, WithClock(func() time.Time { return now }))
+	defer r.Stop()
+	if got, want := r.TimeToExpiry(), r.Leaf().NotAfter.Sub(now); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	now = r.Leaf().NotAfter.Add(time.Minute)
+	if got := r.TimeToExpiry(); got != -time.Minute {
+		t.Errorf("got %v after expiry, want %v", got, -time.Minute)
+	}
+}
+
+func TestClock(t *testing.T) {
+	start := time.Now().Add(-30 * time.Minute)
+	now := start
+	r := newTestReloader(t, WithClock(func() time.Time { return now }), WithStaleAfter(time.Minute), WithOnError(func(error) {}))
+	defer r.Stop()
+	if ok, reason := r.Healthy(); !ok {
+		t.Errorf("got unhealthy %q initially", reason)
+	}
+	if h := r.History(); len(h) != 1 || !h[0].Start.Equal(start) {
+		t.Errorf("got history %+v, want start at %v", h, start)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if ok, reason := r.Healthy(); ok || !strings.Contains(reason, "no successful reload") {
+		t.Errorf("got %v, %q when stale by clock", ok, reason)
+	}
+	if _, err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, reason := r.Healthy(); !ok {
+		t.Errorf("got unhealthy %q after reload", reason)
+	}
+	writeTestFile(t, r.KeyPath(), nil)
+	r.tick()
+	if got := r.Stats().LastFailure; !got.Equal(now) {
+		t.Errorf("got last failure at %v, want %v", got, now)
+	}
+
+	now = r.Leaf().NotAfter.Add(time.Minute)
+	if ok, reason := r.Healthy(); ok || !strings.Contains(reason, "expired") {
+		t.Errorf("got %v, %q after expiry by clock", ok, reason)
+	}
+}
+
+func TestKeyType(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	if got := r.KeyType(); got != "ECDSA P-256" {
+		t.Errorf("got %q, want ECDSA P-256", got)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		pub  crypto.PublicKey
+		want string
+	}{
+		{&rsaKey.PublicKey, "RSA 1024"},
+		{&ecKey.PublicKey, "ECDSA P-384"},
+		{edPub, "Ed25519"},
+	} {
+		if got := keyType(tc.pub); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+	if !strings.Contains(summary(r.Leaf()), `key="ECDSA P-256"`) {
+		t.Errorf("key type missing in %s", summary(r.Leaf()))
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var empty Reloader
+	if status := empty.Status(); !reflect.DeepEqual(status, Status{}) {
+		t.Errorf("got %+v without certificate", status)
+	}
+	before := time.Now()
+	r := newTestReloader(t)
+	defer r.Stop()
+	status := r.Status()
+	leaf := r.Leaf()
+	if status.Subject != "CN=example" || !reflect.DeepEqual(status.DNSNames, []string{"example"}) ||
+		!status.NotAfter.Equal(leaf.NotAfter) || status.KeyType != "ECDSA P-256" ||
+		status.Fingerprint != r.fingerprint(leaf) || status.Installed.Before(before) {
+		t.Errorf("got %+v", status)
+	}
+}
+
+func TestSANs(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	names := r.DNSNames()
+	if !reflect.DeepEqual(names, []string{"example"}) {
+		t.Errorf("got %q, want %q", names, []string{"example"})
+	}
+	names[0] = "modified"
+	if r.Leaf().DNSNames[0] != "example" {
+		t.Error("DNSNames exposes the leaf")
+	}
+	if ips := r.IPAddresses(); ips != nil {
+		t.Errorf("got %v, want none", ips)
+	}
+}
+
+func TestSupports(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	hello := func(serverName string, scheme tls.SignatureScheme) *tls.ClientHelloInfo {
+		return &tls.ClientHelloInfo{
+			ServerName:        serverName,
+			SupportedVersions: []uint16{tls.VersionTLS13},
+			SignatureSchemes:  []tls.SignatureScheme{scheme},
+		}
+	}
+	if err := r.Supports(hello("example", tls.ECDSAWithP256AndSHA256)); err != nil {
+		t.Errorf("got %v, want supported", err)
+	}
+	for _, chi := range []*tls.ClientHelloInfo{
+		hello("other.example", tls.ECDSAWithP256AndSHA256),
+		hello("example", tls.PSSWithSHA256),
+	} {
+		want := chi.SupportsCertificate(r.Get())
+		if got := r.Supports(chi); got == nil || got.Error() != want.Error() {
+			t.Errorf("%s, %v: got %v, want %v", chi.ServerName, chi.SignatureSchemes, got, want)
+		}
+	}
+}
+
+func TestStartupSummary(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want bool
+	}{
+		{"enabled", []Option{WithStartupSummary()}, true},
+		{"disabled", nil, false},
+	} {
+		buf.Reset()
+		r := newTestReloader(t, tc.opts...)
+		r.Stop()
+		got := buf.String()
+		if logged := strings.Contains(got, "loaded certificate: "); logged != tc.want {
+			t.Errorf("%s: got %q", tc.name, got)
+			continue
+		}
+		if !tc.want {
+			continue
+		}
+		leaf := r.Leaf()
+		for _, field := range []string{
+			`subject="CN=example"`,
+			"sans=[example]",
+			"serial=" + leaf.SerialNumber.Text(16),
+			"not_after=" + leaf.NotAfter.Format(time.RFC3339),
+			"sha256=" + fingerprint(leaf),
+		} {
+			if !strings.Contains(got, field) {
+				t.Errorf("%s: %q lacks %s", tc.name, got, field)
+			}
+		}
+		if strings.Contains(got, "PRIVATE") {
+			t.Errorf("%s: %q includes private key", tc.name, got)
+		}
+	}
+}
+
+func TestGetCopy(t *testing.T) {
+	r := newTestReloader(t)
+	defer r.Stop()
+	cert := r.GetCopy()
+	checkConsistent(t, cert)
+	if cert == r.Get() || !bytes.Equal(cert.Certificate[0], r.Get().Certificate[0]) {
+		t.Fatal("got no copy of the loaded certificate")
+	}
+
+	// Modifying the copy leaves served certificate alone.
+	want := append([]byte(nil), r.Get().Certificate[0]...)
+	cert.Certificate[0][0] ^= 0xff
+	cert.Certificate = append(cert.Certificate, []byte("extra"))
+	cert.OCSPStaple = []byte("staple")
+	cert.SupportedSignatureAlgorithms = append(cert.SupportedSignatureAlgorithms, tls.PKCS1WithSHA1)
+	served, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(served.Certificate) != 1 || !bytes.Equal(served.Certificate[0], want) ||
+		served.OCSPStaple != nil || len(served.SupportedSignatureAlgorithms) != 0 {
+		t.Errorf("modifying copy changed served certificate %+v", served)
+	}
+	checkConsistent(t, r.Get())
+
+	certPath, _ := writeTestPair(t, t.TempDir(), "example")
+	certOnly, err := NewCertOnly(certPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer certOnly.Stop()
+	if certOnly.GetCopy() != nil {
+		t.Error("got copy in certificate-only mode")
+	}
+}
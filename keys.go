@@ -0,0 +1,169 @@
+package certreloader
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cespare/xxhash"
+)
+
+var (
+	errInvalidKeyPaths     = errors.New("invalid key paths")
+	errFixedKeyUnsupported = errors.New("fixed key requires a separate private key")
+
+	// ErrKeyMismatch is wrapped by reload errors if the private key does not
+	// belong to the leaf certificate.
+	ErrKeyMismatch = errors.New("private key does not match certificate")
+)
+
+// NewWithKeys return a new Reloader which pairs the certificate with the first
+// of keyPaths matching it, e.g. to smooth a key rollover during which the
+// certificate may briefly belong to either of two keys. Unreadable candidates
+// are skipped, and a reload fails only if none of them matches. Pairing with
+// another than the first candidate is reported as a warning (see
+// WithOnWarning). Otherwise it works like New.
+func NewWithKeys(certPath string, keyPaths []string, interval time.Duration, opts ...Option) (*Reloader, error) {
+	if certPath == "" {
+		return nil, errInvalidCertPath
+	}
+	if len(keyPaths) == 0 {
+		return nil, errInvalidKeyPaths
+	}
+	for _, p := range keyPaths {
+		if p == "" {
+			return nil, errInvalidKeyPath
+		}
+	}
+	alts := make([]source, len(keyPaths)-1)
+	for i, p := range keyPaths[1:] {
+		alts[i] = pathSource(p)
+	}
+	opts = append([]Option{func(r *Reloader) { r.keyAlts = alts }}, opts...)
+	return newReloader(pathSource(certPath), pathSource(keyPaths[0]), interval, opts)
+}
+
+// keySources returns all candidate key sources in order of preference.
+func (r *Reloader) keySources() []source {
+	if r.keySrc == nil {
+		return nil
+	}
+	return append([]source{r.keySrc}, r.keyAlts...)
+}
+
+// loadKeys reads all candidate keys, and computes a digest over all of them.
+// Unreadable ones are left nil, unless there is only one candidate or none of
+// them is readable.
+func (r *Reloader) loadKeys(ctx context.Context) (keyPEMs [][]byte, dgst uint64, err error) {
+	srcs := r.keySources()
+	if len(srcs) <= 1 {
+		var keyPEM []byte
+		if keyPEM, dgst, err = r.load(ctx, r.keySrc); err != nil {
+			return
+		}
+		return [][]byte{keyPEM}, dgst, nil
+	}
+	h := xxhash.New()
+	var firstErr error
+	keyPEMs = make([][]byte, len(srcs))
+	for i, src := range srcs {
+		data, d, err := r.load(ctx, src)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			d = 0
+		} else {
+			keyPEMs[i] = data
+		}
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], d)
+		h.Write(buf[:])
+	}
+	for _, keyPEM := range keyPEMs {
+		if keyPEM != nil {
+			return keyPEMs, h.Sum64(), nil
+		}
+	}
+	return nil, 0, firstErr
+}
+
+// readKeys loads candidate keys like loadKeys, and checks that they are
+// complete. Keys are converted to PEM if WithBase64DERKey was given, zeroing
+// the base64 read. reason describes a failure.
+func (r *Reloader) readKeys(ctx context.Context) (keyPEMs [][]byte, dgst uint64, reason string, err error) {
+	if keyPEMs, dgst, err = r.loadKeys(ctx); err != nil {
+		return nil, 0, reasonReadFailed, err
+	}
+	srcs := r.keySources()
+	for i, keyPEM := range keyPEMs {
+		if keyPEM == nil {
+			continue
+		}
+		keyPEM = trimBOM(keyPEM)
+		if r.base64Key {
+			raw := keyPEM
+			keyPEM, err = wrapBase64Key(srcs[i], raw)
+			zero(raw)
+		} else {
+			err = checkComplete(srcs[i], keyPEM)
+		}
+		if err != nil {
+			if errors.Is(err, ErrIncompleteFile) {
+				return nil, 0, reasonIncomplete, err
+			}
+			return nil, 0, reasonRejected, err
+		}
+		keyPEMs[i] = keyPEM
+	}
+	return
+}
+
+// pairKeys pairs certPEM with the first matching of keyPEMs. Pairing with
+// another than the preferred candidate is appended to warnings, since it
+// usually means that a key rollover is in progress.
+func (r *Reloader) pairKeys(certPEM []byte, keyPEMs [][]byte, warnings *[]error) (cert tls.Certificate, err error) {
+	if len(keyPEMs) == 1 {
+		if cert, err = tls.X509KeyPair(certPEM, keyPEMs[0]); err != nil {
+			err = explainPairError(certPEM, keyPEMs[0], err)
+		}
+		return
+	}
+	var firstErr error
+	for i, keyPEM := range keyPEMs {
+		if keyPEM == nil {
+			continue
+		}
+		if cert, err = tls.X509KeyPair(certPEM, keyPEM); err == nil {
+			if i > 0 {
+				*warnings = append(*warnings, fmt.Errorf("paired certificate with key %s instead of %s",
+					r.keySources()[i].name(), r.keySrc.name()))
+			}
+			return
+		}
+		if firstErr == nil {
+			firstErr = explainPairError(certPEM, keyPEM, err)
+		}
+	}
+	return cert, fmt.Errorf("no candidate key matches certificate: %w", firstErr)
+}
+
+// checkKeyMatch verifies explicitly that the private key of cert belongs to
+// its leaf, since not every way of obtaining a key, such as a platform key
+// store, goes through the check of tls.X509KeyPair.
+func checkKeyMatch(cert *tls.Certificate) error {
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("%w: %T is not a crypto.Signer", ErrKeyMismatch, cert.PrivateKey)
+	}
+	pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(cert.Leaf.PublicKey) {
+		return fmt.Errorf("%w: public key %T of private key differs from %T of %s",
+			ErrKeyMismatch, signer.Public(), cert.Leaf.PublicKey, summary(cert.Leaf))
+	}
+	return nil
+}
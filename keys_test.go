@@ -0,0 +1,281 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewWithKeys(t *testing.T) {
+	dir := t.TempDir()
+	certPath, newKeyPath := writeTestPair(t, dir, "example")
+	_, oldKeyPEM := newTestPair(t, "example")
+	oldKeyPath := filepath.Join(dir, "old.pem")
+	writeTestFile(t, oldKeyPath, oldKeyPEM)
+	missingPath := filepath.Join(dir, "missing.pem")
+
+	var warnings []error
+	onWarning := WithOnWarning(func(err error) { warnings = append(warnings, err) })
+	r, err := NewWithKeys(certPath, []string{missingPath, oldKeyPath, newKeyPath}, time.Hour, onWarning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	checkConsistent(t, r.Get())
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), newKeyPath) {
+		t.Errorf("got warnings %v, want pairing with %s", warnings, newKeyPath)
+	}
+
+	// Pairing with the preferred key is not worth a warning.
+	warnings = nil
+	preferred, err := NewWithKeys(certPath, []string{newKeyPath, oldKeyPath}, time.Hour, onWarning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer preferred.Stop()
+	if len(warnings) != 0 {
+		t.Errorf("got warnings %v", warnings)
+	}
+
+	if _, err = NewWithKeys(certPath, []string{missingPath, oldKeyPath}, time.Hour); err == nil {
+		t.Error("got no error without matching key")
+	}
+}
+
+// mismatchedSigner is a signerSource whose key belongs to another certificate.
+type mismatchedSigner struct {
+	pathSource
+	key crypto.Signer
+}
+
+func (s mismatchedSigner) signer(*x509.Certificate) (crypto.Signer, error) {
+	return s.key, nil
+}
+
+func TestKeyMismatch(t *testing.T) {
+	dir := t.TempDir()
+	certPath, _ := writeTestPair(t, dir, "example")
+	_, otherKeyPEM := newTestPair(t, "other")
+	otherKeyPath := filepath.Join(dir, "other.pem")
+	writeTestFile(t, otherKeyPath, otherKeyPEM)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKeyPath := filepath.Join(dir, "rsa.pem")
+	writeTestFile(t, rsaKeyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+
+	for _, keyPath := range []string{otherKeyPath, rsaKeyPath} {
+		if _, err := New(certPath, keyPath, time.Hour); !errors.Is(err, ErrKeyMismatch) {
+			t.Errorf("%s: got %v, want %v", keyPath, err, ErrKeyMismatch)
+		}
+	}
+	if _, err := NewWithKeys(certPath, []string{otherKeyPath, rsaKeyPath}, time.Hour); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("got %v, want %v", err, ErrKeyMismatch)
+	}
+	src := mismatchedSigner{pathSource(certPath), rsaKey}
+	if _, err := newReloader(pathSource(certPath), src, time.Hour, []Option{WithRelativePaths()}); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("signer: got %v, want %v", err, ErrKeyMismatch)
+	}
+}
+
+func TestRareKeyChanges(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	keyReads := 0
+	r, err := New(certPath, keyPath, time.Hour, WithRareKeyChanges(3), withReadFile(func(path string) ([]byte, error) {
+		if path == keyPath {
+			keyReads++
+		}
+		return ioutil.ReadFile(path)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	for i := 0; i < 6; i++ {
+		r.Reload()
+	}
+	if want := 1 + 2; keyReads != want {
+		t.Errorf("key read %d times, want %d", keyReads, want)
+	}
+
+	keyReads = 0
+	writeTestPair(t, dir, "example")
+	if res, err := r.Reload(); err != nil || !res.Changed || keyReads != 1 {
+		t.Errorf("got %+v, %v, %d key reads after changing both", res, err, keyReads)
+	}
+}
+
+func TestKeyDecryptFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		encrypt func(t *testing.T, block *pem.Block, passphrase string) *pem.Block
+	}{
+		{"legacy", func(t *testing.T, block *pem.Block, passphrase string) *pem.Block {
+			block, err := x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES256)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return block
+		}},
+		{"pbes2", func(t *testing.T, block *pem.Block, passphrase string) *pem.Block {
+			return &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encryptPKCS8(t, block.Bytes, []byte(passphrase))}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			passPath := filepath.Join(dir, "pass")
+			// writeEncryptedPair writes a new pair with its key encrypted by
+			// passphrase.
+			writeEncryptedPair := func(passphrase string) {
+				certPEM, keyPEM := newTestPair(t, "example")
+				block, _ := pem.Decode(keyPEM)
+				writeTestFile(t, filepath.Join(dir, "cert.pem"), certPEM)
+				writeTestFile(t, filepath.Join(dir, "key.pem"), pem.EncodeToMemory(tc.encrypt(t, block, passphrase)))
+			}
+			writeEncryptedPair("old")
+			writeTestFile(t, passPath, []byte("old\n"))
+			var errs []error
+			r, err := New(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), time.Hour,
+				WithKeyPassphraseFile(passPath), WithOnError(func(err error) { errs = append(errs, err) }))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			old := r.Get()
+
+			// The key is rotated before its passphrase.
+			writeEncryptedPair("new")
+			r.tick()
+			if len(errs) != 1 || !errors.Is(errs[0], ErrKeyDecrypt) {
+				t.Fatalf("got %v, want %v", errs, ErrKeyDecrypt)
+			}
+			if r.Get() != old {
+				t.Fatal("certificate replaced despite decryption failure")
+			}
+
+			writeTestFile(t, passPath, []byte("new\n"))
+			r.tick()
+			if len(errs) != 1 {
+				t.Fatalf("unexpected errors %v", errs[1:])
+			}
+			if r.Get() == old {
+				t.Error("certificate not reloaded after passphrase was corrected")
+			}
+		})
+	}
+}
+
+func TestBase64DERKey(t *testing.T) {
+	dir := t.TempDir()
+	certPEM, keyPEM := newTestPair(t, "example")
+	block, _ := pem.Decode(keyPEM)
+	encoded := base64.StdEncoding.EncodeToString(block.Bytes)
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.b64")
+	writeTestFile(t, certPath, certPEM)
+
+	for _, tc := range []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{"plain", encoded, nil},
+		{"wrapped", encoded[:40] + "\r\n" + encoded[40:] + "\n", nil},
+		{"empty", "\n", ErrIncompleteFile},
+		{"truncated", encoded[:len(encoded)-3], ErrIncompleteFile},
+		{"pem", string(keyPEM), errInvalidBase64Key},
+		{"garbage", encoded[:20] + "!" + encoded[21:], errInvalidBase64Key},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writeTestFile(t, keyPath, []byte(tc.data))
+			var raw []byte
+			r, err := New(certPath, keyPath, time.Hour, WithBase64DERKey(), withReadFile(func(path string) ([]byte, error) {
+				data, err := ioutil.ReadFile(path)
+				if path == keyPath {
+					raw = data
+				}
+				return data, err
+			}))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if len(bytes.Trim(raw, "\x00")) != 0 {
+				t.Errorf("base64 key left in memory: %q", raw)
+			}
+			if err == nil {
+				defer r.Stop()
+				checkConsistent(t, r.Get())
+			}
+		})
+	}
+}
+
+func TestFixedKey(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	var keyReads int
+	readFile := func(path string) ([]byte, error) {
+		if path == keyPath {
+			keyReads++
+		}
+		return ioutil.ReadFile(path)
+	}
+	r, err := New(certPath, keyPath, time.Hour, WithFixedKey(), withReadFile(readFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	key := r.Get().PrivateKey
+
+	// A renewed certificate for the same key is paired with it.
+	block, _ := pem.Decode(mustReadTestFile(t, keyPath))
+	signer, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ca, caKey := issueTestCert(t, "ca", true, nil, nil)
+	tmpl := *r.Leaf()
+	tmpl.Subject.CommonName = "renewed"
+	tmpl.RawSubject = nil
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, ca, signer.(crypto.Signer).Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v for renewed certificate", res, err)
+	}
+	checkConsistent(t, r.Get())
+	if r.Leaf().Subject.CommonName != "renewed" || r.Get().PrivateKey != key {
+		t.Error("renewed certificate not paired with fixed key")
+	}
+
+	// A certificate for another key is rejected, even along with that key.
+	writeTestPair(t, dir, "rekeyed")
+	if _, err := r.Reload(); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("got %v, want %v", err, ErrKeyMismatch)
+	}
+	if r.Leaf().Subject.CommonName != "renewed" {
+		t.Error("mismatched certificate replaced previous one")
+	}
+	if keyReads != 1 {
+		t.Errorf("key read %d times, want once", keyReads)
+	}
+
+	if _, err := NewCertOnly(certPath, time.Hour, WithFixedKey()); err != errFixedKeyUnsupported {
+		t.Errorf("got %v in certificate-only mode, want %v", err, errFixedKeyUnsupported)
+	}
+}
@@ -0,0 +1,82 @@
+package certreloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPause(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	r, err := New(certPath, keyPath, time.Hour, WithClock(func() time.Time { return now }), WithStaleAfter(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// Staged files are not picked up while paused, and skipped ticks keep the
+	// reloader healthy.
+	r.Pause()
+	writeTestPair(t, dir, "staged")
+	now = now.Add(2 * time.Minute)
+	r.tick()
+	if cn := r.Leaf().Subject.CommonName; cn != "example" {
+		t.Errorf("installed %q while paused", cn)
+	}
+	if ok, reason := r.Healthy(); !ok {
+		t.Errorf("got unhealthy %q while paused", reason)
+	}
+	if stats := r.Stats(); stats.Attempts != 1 {
+		t.Errorf("got %d attempts while paused, want 1", stats.Attempts)
+	}
+
+	// Explicit reloads are not affected.
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v from Reload while paused", res, err)
+	}
+
+	writeTestPair(t, dir, "resumed")
+	r.Resume(false)
+	if cn := r.Leaf().Subject.CommonName; cn != "staged" {
+		t.Errorf("got %q after Resume without reload, want staged", cn)
+	}
+	r.Pause()
+	r.Resume(true)
+	if cn := r.Leaf().Subject.CommonName; cn != "resumed" {
+		t.Errorf("got %q after Resume with reload, want resumed", cn)
+	}
+
+	// Nothing is reloaded after Stop.
+	r.Stop()
+	attempts := r.Stats().Attempts
+	r.Pause()
+	r.Resume(true)
+	if stats := r.Stats(); stats.Attempts != attempts {
+		t.Errorf("got %d attempts after Resume with reload after Stop, want %d", stats.Attempts, attempts)
+	}
+}
+
+func TestManualStart(t *testing.T) {
+	r := newTestReloader(t, WithManualStart())
+	defer r.Stop()
+	if !r.NextReload().IsZero() {
+		t.Error("reloading started before Start")
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for r.NextReload().IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("reloading not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	r.Stop()
+	if err := r.Start(); err != errStopped {
+		t.Errorf("got %v, want %v", err, errStopped)
+	}
+}
@@ -0,0 +1,176 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"errors"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Manager manages a set of Reloaders identified by name, e.g. one certificate
+// / private key pair per tenant. Its methods are safe for concurrent use.
+type Manager struct {
+	mu        sync.RWMutex
+	reloaders map[string]*Reloader
+	entries   []managerEntry // sorted by name, replaced on write
+	sem       chan struct{}  // bounds concurrent reloads of all pairs
+
+	selections    sync.Map // selectionKey to *atomic.Uint64
+	numSelections atomic.Int64
+}
+
+var errDuplicateName = errors.New("name already registered")
+
+// ManagerOption configures a Manager.
+type ManagerOption func(*Manager)
+
+// WithReloadConcurrency bounds how many reloads of registered pairs run at
+// once, whether in background, from ReloadAll or from Reload of a single
+// pair, so that a large fleet does not read all of its files from shared
+// storage at once. Further reloads wait for a slot. It defaults to the number
+// of CPUs; a non-positive n keeps the default.
+func WithReloadConcurrency(n int) ManagerOption {
+	return func(m *Manager) {
+		if n > 0 {
+			m.sem = make(chan struct{}, n)
+		}
+	}
+}
+
+// NewManager returns an empty Manager.
+func NewManager(opts ...ManagerOption) *Manager {
+	m := &Manager{
+		reloaders: make(map[string]*Reloader),
+		sem:       make(chan struct{}, runtime.NumCPU()),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Add registers a certificate / private key pair under name. Arguments are
+// passed to New, whose error is returned if the initial reload failed.
+func (m *Manager) Add(name, certPath, keyPath string, interval time.Duration, opts ...Option) error {
+	m.mu.RLock()
+	_, exists := m.reloaders[name]
+	m.mu.RUnlock()
+	if exists {
+		return errDuplicateName
+	}
+	opts = append(opts, func(r *Reloader) { r.sem = m.sem })
+	r, err := New(certPath, keyPath, interval, opts...)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists = m.reloaders[name]; exists {
+		r.Stop()
+		return errDuplicateName
+	}
+	m.reloaders[name] = r
+	m.sortEntries()
+	return nil
+}
+
+// Get returns currently loaded tls.Certificate of the pair registered under
+// name.
+func (m *Manager) Get(name string) (*tls.Certificate, bool) {
+	m.mu.RLock()
+	r, ok := m.reloaders[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return r.Get(), true
+}
+
+// Remove stops reloading the pair registered under name and forgets it, and
+// reports whether it was registered. Other pairs are not affected.
+func (m *Manager) Remove(name string) bool {
+	m.mu.Lock()
+	r, ok := m.reloaders[name]
+	delete(m.reloaders, name)
+	m.sortEntries()
+	m.mu.Unlock()
+	if ok {
+		r.Stop()
+	}
+	return ok
+}
+
+// Range calls fn for each registered pair in order of name, with its currently
+// loaded tls.Certificate, until fn returns false. It works on a snapshot taken
+// before the first call, so fn may call other methods of m.
+func (m *Manager) Range(fn func(name string, cert *tls.Certificate) bool) {
+	for _, e := range m.snapshot() {
+		if !fn(e.name, e.r.Get()) {
+			return
+		}
+	}
+}
+
+// ReloadAll reloads all registered pairs immediately, like Reloader.Reload,
+// and returns the error of each pair by name, which is nil if its reload
+// succeeded. Reloads run concurrently as far as WithReloadConcurrency allows.
+func (m *Manager) ReloadAll() map[string]error {
+	entries := m.snapshot()
+	errs := make([]error, len(entries))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < cap(m.sem) && w < len(entries); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				_, errs[i] = entries[i].r.Reload()
+			}
+		}()
+	}
+	for i := range entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	results := make(map[string]error, len(entries))
+	for i, e := range entries {
+		results[e.name] = errs[i]
+	}
+	return results
+}
+
+// Stop stops all registered Reloaders.
+func (m *Manager) Stop() {
+	for _, e := range m.snapshot() {
+		e.r.Stop()
+	}
+}
+
+type managerEntry struct {
+	name string
+	r    *Reloader
+}
+
+// snapshot returns registered pairs in order of name, which must not be
+// modified.
+func (m *Manager) snapshot() []managerEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.entries
+}
+
+// sortEntries rebuilds m.entries with m.mu held.
+func (m *Manager) sortEntries() {
+	entries := make([]managerEntry, 0, len(m.reloaders))
+	for name, r := range m.reloaders {
+		entries = append(entries, managerEntry{name, r})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	m.entries = entries
+}
@@ -0,0 +1,178 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestManager(t *testing.T, names ...string) *Manager {
+	t.Helper()
+	m := NewManager()
+	t.Cleanup(m.Stop)
+	for _, name := range names {
+		dir := t.TempDir()
+		certPath, keyPath := writeTestPair(t, dir, name)
+		if err := m.Add(name, certPath, keyPath, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestManagerRange(t *testing.T) {
+	m := newTestManager(t, "b.example", "a.example", "c.example")
+
+	var names []string
+	m.Range(func(name string, cert *tls.Certificate) bool {
+		if cn := cert.Leaf.Subject.CommonName; cn != name {
+			t.Errorf("got certificate for %q under %q", cn, name)
+		}
+		names = append(names, name)
+		return name != "b.example"
+	})
+	if want := []string{"a.example", "b.example"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
+
+func TestManagerAddDuplicate(t *testing.T) {
+	m := newTestManager(t, "a.example")
+	certPath, keyPath := writeTestPair(t, t.TempDir(), "a.example")
+	if err := m.Add("a.example", certPath, keyPath, time.Hour); err != errDuplicateName {
+		t.Errorf("got %v, want %v", err, errDuplicateName)
+	}
+}
+
+func TestManagerRemove(t *testing.T) {
+	m := newTestManager(t, "a.example", "b.example")
+	if !m.Remove("a.example") {
+		t.Fatal("a.example was not registered")
+	}
+	if m.Remove("a.example") {
+		t.Error("a.example removed twice")
+	}
+	if cert, ok := m.Get("a.example"); ok || cert != nil {
+		t.Errorf("got %v, %v for removed pair", cert, ok)
+	}
+	if _, ok := m.Get("b.example"); !ok {
+		t.Error("b.example was removed")
+	}
+}
+
+func TestManagerReloadAll(t *testing.T) {
+	m := newTestManager(t, "a.example", "b.example", "c.example")
+	writeTestFile(t, m.reloaders["b.example"].CertPath(), []byte("garbage"))
+	errs := m.ReloadAll()
+	if len(errs) != 3 {
+		t.Fatalf("got %d results, want 3", len(errs))
+	}
+	for name, err := range errs {
+		if (err != nil) != (name == "b.example") {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
+
+// inflight tracks how many files are read at once.
+type inflight struct {
+	cur, max atomic.Int32
+}
+
+func (f *inflight) readFile(path string) ([]byte, error) {
+	n := f.cur.Add(1)
+	defer f.cur.Add(-1)
+	for {
+		max := f.max.Load()
+		if n <= max || f.max.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond) // like slow shared storage
+	return ioutil.ReadFile(path)
+}
+
+// newInflightManager returns a Manager of n pairs whose files are read
+// through f.
+func newInflightManager(t testing.TB, n int, f *inflight, opts ...ManagerOption) *Manager {
+	t.Helper()
+	m := NewManager(opts...)
+	t.Cleanup(m.Stop)
+	for i := 0; i < n; i++ {
+		certPath, keyPath := writeTestPair(t, t.TempDir(), "example")
+		if err := m.Add(fmt.Sprint(i), certPath, keyPath, time.Hour, withReadFile(f.readFile)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+func TestManagerReloadConcurrency(t *testing.T) {
+	var f inflight
+	m := newInflightManager(t, 16, &f, WithReloadConcurrency(2))
+	f.max.Store(0)
+	for name, err := range m.ReloadAll() {
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if max := f.max.Load(); max > 2 {
+		t.Errorf("got %d concurrent reloads, want at most 2", max)
+	}
+	if got, want := cap(NewManager(WithReloadConcurrency(0)).sem), runtime.NumCPU(); got != want {
+		t.Errorf("got concurrency %d by default, want %d", got, want)
+	}
+}
+
+// BenchmarkManagerReloadAll measures ReloadAll of many pairs on slow storage
+// with various concurrency limits, reporting the most concurrent reads seen.
+func BenchmarkManagerReloadAll(b *testing.B) {
+	for _, n := range []int{1, 4, runtime.NumCPU()} {
+		b.Run(fmt.Sprintf("concurrency=%d", n), func(b *testing.B) {
+			var f inflight
+			m := newInflightManager(b, 256, &f, WithReloadConcurrency(n))
+			f.max.Store(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.ReloadAll()
+			}
+			b.ReportMetric(float64(f.max.Load()), "max-inflight")
+		})
+	}
+}
+
+func TestManagerGetCertificate(t *testing.T) {
+	m := newTestManager(t, "a.example", "b.example")
+	hello := func(serverName string) *tls.ClientHelloInfo {
+		return &tls.ClientHelloInfo{
+			ServerName:        serverName,
+			SupportedVersions: []uint16{tls.VersionTLS13},
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		}
+	}
+	for _, serverName := range []string{"b.example", "a.example", "b.example"} {
+		cert, err := m.GetCertificate(hello(serverName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cn := cert.Leaf.Subject.CommonName; cn != serverName {
+			t.Errorf("got %s for %s", cn, serverName)
+		}
+	}
+	if _, err := m.GetCertificate(hello("c.example")); err != errNoCertificate {
+		t.Errorf("got %v, want %v", err, errNoCertificate)
+	}
+	want := []SelectionStat{
+		{"", "c.example", 1},
+		{"a.example", "a.example", 1},
+		{"b.example", "b.example", 2},
+	}
+	if got := m.SelectionStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
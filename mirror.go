@@ -0,0 +1,114 @@
+package certreloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	errInvalidMirrors = errors.New("invalid mirror paths or quorum")
+	errNoQuorum       = errors.New("mirrors disagree")
+)
+
+// NewFromMirrors return a new Reloader reading certificate / private key from
+// several replicated copies each, e.g. on different mounts. On each reload all
+// copies are read, and the contents agreed on by at least quorum copies of
+// certificate and of private key are used. Otherwise the reload fails listing
+// the diverging copies, keeping the previously loaded certificate, so that a
+// partially synchronized mirror is never served. Unreadable copies count as
+// diverging. A non-positive quorum means a majority. Otherwise it works like
+// New.
+func NewFromMirrors(certPaths, keyPaths []string, quorum int, interval time.Duration, opts ...Option) (*Reloader, error) {
+	certSrc, err := newMirrorSource(certPaths, quorum)
+	if err != nil {
+		return nil, err
+	}
+	keySrc, err := newMirrorSource(keyPaths, quorum)
+	if err != nil {
+		return nil, err
+	}
+	return newReloader(certSrc, keySrc, interval, opts)
+}
+
+// mirrorSource reads the copy agreed on by a quorum of mirrors.
+type mirrorSource struct {
+	mirrors []pathSource
+	quorum  int
+}
+
+func newMirrorSource(paths []string, quorum int) (mirrorSource, error) {
+	if quorum <= 0 {
+		quorum = len(paths)/2 + 1
+	}
+	if len(paths) == 0 || quorum > len(paths) {
+		return mirrorSource{}, errInvalidMirrors
+	}
+	s := mirrorSource{quorum: quorum}
+	for _, p := range paths {
+		if p == "" {
+			return mirrorSource{}, errInvalidMirrors
+		}
+		s.mirrors = append(s.mirrors, pathSource(p))
+	}
+	return s, nil
+}
+
+func (s mirrorSource) read(ctx context.Context, limit int64) ([]byte, error) {
+	contents := make([][]byte, len(s.mirrors))
+	errs := make([]error, len(s.mirrors))
+	for i, m := range s.mirrors {
+		contents[i], errs[i] = m.read(ctx, limit)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	best, votes := -1, 0
+	for i := range s.mirrors {
+		if errs[i] != nil {
+			continue
+		}
+		n := 0
+		for j := range s.mirrors {
+			if errs[j] == nil && bytes.Equal(contents[i], contents[j]) {
+				n++
+			}
+		}
+		if n > votes {
+			best, votes = i, n
+		}
+	}
+	if votes >= s.quorum {
+		return contents[best], nil
+	}
+	var diverged []string
+	for i, m := range s.mirrors {
+		switch {
+		case errs[i] != nil:
+			diverged = append(diverged, errs[i].Error())
+		case !bytes.Equal(contents[i], contents[best]):
+			diverged = append(diverged, m.name())
+		}
+	}
+	return nil, fmt.Errorf("%s: %w, %d of %d agree with quorum of %d, diverged: %s",
+		s.name(), errNoQuorum, votes, len(s.mirrors), s.quorum, strings.Join(diverged, ", "))
+}
+
+func (s mirrorSource) name() string {
+	return string(s.mirrors[0])
+}
+
+func (s mirrorSource) abs() (source, error) {
+	mirrors := make([]pathSource, len(s.mirrors))
+	for i, m := range s.mirrors {
+		abs, err := m.abs()
+		if err != nil {
+			return nil, err
+		}
+		mirrors[i] = abs.(pathSource)
+	}
+	return mirrorSource{mirrors, s.quorum}, nil
+}
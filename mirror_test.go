@@ -0,0 +1,60 @@
+package certreloader
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewFromMirrors(t *testing.T) {
+	var certPaths, keyPaths []string
+	certPEM, keyPEM := newTestPair(t, "example")
+	writeMirror := func(i int, certPEM, keyPEM []byte) {
+		writeTestFile(t, certPaths[i], certPEM)
+		writeTestFile(t, keyPaths[i], keyPEM)
+	}
+	for i := 0; i < 3; i++ {
+		dir := t.TempDir()
+		certPaths = append(certPaths, filepath.Join(dir, "cert.pem"))
+		keyPaths = append(keyPaths, filepath.Join(dir, "key.pem"))
+		writeMirror(i, certPEM, keyPEM)
+	}
+	if _, err := NewFromMirrors(certPaths, keyPaths, 4, time.Hour); err != errInvalidMirrors {
+		t.Errorf("got %v, want %v", err, errInvalidMirrors)
+	}
+	r, err := NewFromMirrors(certPaths, keyPaths, 0, time.Hour, WithOnError(func(error) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	old := r.Get()
+
+	// A single stale mirror is outvoted.
+	certPEM, keyPEM = newTestPair(t, "example")
+	writeMirror(0, certPEM, keyPEM)
+	writeMirror(1, certPEM, keyPEM)
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %v, %v, want new certificate", res, err)
+	}
+	old = r.Get()
+
+	// No two mirrors agree.
+	certPEM, keyPEM = newTestPair(t, "example")
+	writeMirror(0, certPEM, keyPEM)
+	otherCertPEM, otherKeyPEM := newTestPair(t, "example")
+	writeMirror(1, otherCertPEM, otherKeyPEM)
+	_, err = r.Reload()
+	if !errors.Is(err, errNoQuorum) {
+		t.Fatalf("got %v, want %v", err, errNoQuorum)
+	}
+	for _, p := range certPaths[1:] {
+		if !strings.Contains(err.Error(), p) {
+			t.Errorf("error %q does not mention diverged %s", err, p)
+		}
+	}
+	if r.Get() != old {
+		t.Error("certificate replaced without quorum")
+	}
+}
@@ -0,0 +1,93 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+var errNoCACertificates = errors.New("failed to find any CA certificate")
+
+// GetConfigForClient returns a tls.Config serving currently loaded certificate,
+// and trusting the client CA bundle loaded in the same reload if
+// WithClientCAFile is given. It can be used as tls.Config.GetConfigForClient
+// directly, so that handshakes never see a certificate and a client CA bundle
+// from different reloads. The returned config is derived from the one given to
+// WithBaseConfig, or from the preset given to WithTLSPreset, and must not be
+// modified. Clients offering a protocol registered by SetALPNCertificate get
+// a config serving only that certificate and protocol, and those requesting a
+// name registered by SetServerNameConfig get a config adjusted for it. Expiry
+// is handled as for GetCertificate.
+func (r *Reloader) GetConfigForClient(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+	if r.certOnly {
+		return nil, errCertOnly
+	}
+	snap := r.snapshot()
+	if proto, cert := r.alpnCertificate(chi); cert != nil {
+		config := snap.config.Clone()
+		config.Certificates = []tls.Certificate{*cert}
+		config.NextProtos = []string{proto}
+		return config, nil
+	}
+	o, ok := r.nameOverride(chi)
+	if ok && o.cert != nil {
+		config := snap.config.Clone()
+		config.Certificates = []tls.Certificate{*o.cert}
+		if o.configure != nil {
+			o.configure(config)
+		}
+		return config, nil
+	}
+	cert, err := r.checkExpiry(snap.cert)
+	if err != nil {
+		return nil, err
+	}
+	if cert != snap.cert {
+		config := snap.config.Clone()
+		config.Certificates = []tls.Certificate{*cert}
+		if ok {
+			o.configure(config)
+		}
+		return config, nil
+	}
+	if ok {
+		config := snap.config.Clone()
+		o.configure(config)
+		return config, nil
+	}
+	return snap.config, nil
+}
+
+// ClientCAs returns currently loaded client CA bundle, or nil if
+// WithClientCAFile is not given.
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	if snap := r.snapshot(); snap != nil {
+		return snap.clientCAs
+	}
+	return nil
+}
+
+// newConfig derives a tls.Config for snap from base config.
+func (r *Reloader) newConfig(snap *snapshot) *tls.Config {
+	var config *tls.Config
+	if r.baseConfig != nil {
+		config = r.baseConfig.Clone()
+	} else {
+		config = r.preset.config()
+	}
+	config.Certificates = snap.certificates()
+	config.GetCertificate = nil
+	config.GetConfigForClient = nil
+	if snap.clientCAs != nil {
+		config.ClientCAs = snap.clientCAs
+	}
+	return config
+}
+
+func parseCAs(caPEM []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errNoCACertificates
+	}
+	return pool, nil
+}
@@ -0,0 +1,106 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetConfigForClient(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "server.example")
+	caPath := filepath.Join(dir, "ca.pem")
+	caPEM, _ := newTestPair(t, "ca1.example")
+	writeTestFile(t, caPath, caPEM)
+
+	r, err := New(certPath, keyPath, time.Hour,
+		WithClientCAFile(caPath),
+		WithBaseConfig(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	check := func(wantCA string) {
+		t.Helper()
+		config, err := r.GetConfigForClient(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.ClientAuth != tls.RequireAndVerifyClientCert {
+			t.Error("base config is not honored")
+		}
+		if leaf := config.Certificates[0].Leaf; leaf != r.Get().Leaf {
+			t.Errorf("config serves %q, not currently loaded certificate", leaf.Subject.CommonName)
+		}
+		want := x509.NewCertPool()
+		want.AppendCertsFromPEM(mustReadTestFile(t, caPath))
+		if !config.ClientCAs.Equal(want) || config.ClientCAs != r.ClientCAs() {
+			t.Errorf("config does not trust %s", wantCA)
+		}
+	}
+	check("ca1.example")
+
+	caPEM, _ = newTestPair(t, "ca2.example")
+	writeTestFile(t, caPath, caPEM)
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v after changing CA bundle", res, err)
+	}
+	check("ca2.example")
+
+	writeTestFile(t, caPath, []byte("garbage"))
+	if _, err := r.Reload(); err != errNoCACertificates {
+		t.Fatalf("got %v, want %v", err, errNoCACertificates)
+	}
+	writeTestFile(t, caPath, caPEM)
+	check("ca2.example")
+}
+
+func TestServerNameConfig(t *testing.T) {
+	r := newTestReloader(t, WithBaseConfig(&tls.Config{MinVersion: tls.VersionTLS13}))
+	defer r.Stop()
+	certPEM, keyPEM := newTestPair(t, "legacy.example")
+	legacy, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relax := func(config *tls.Config) { config.MinVersion = tls.VersionTLS10 }
+	r.SetServerNameConfig("Legacy.example", &legacy, relax)
+	r.SetServerNameConfig("relaxed.example", nil, relax)
+
+	for _, tc := range []struct {
+		name       string
+		minVersion uint16
+		cert       *tls.Certificate
+	}{
+		{"other.example", tls.VersionTLS13, r.Get()},
+		{"legacy.example", tls.VersionTLS10, &legacy},
+		{"relaxed.example", tls.VersionTLS10, r.Get()},
+	} {
+		chi := &tls.ClientHelloInfo{ServerName: tc.name}
+		config, err := r.GetConfigForClient(chi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.MinVersion != tc.minVersion {
+			t.Errorf("%s: got MinVersion %x, want %x", tc.name, config.MinVersion, tc.minVersion)
+		}
+		if config.Certificates[0].Leaf != tc.cert.Leaf {
+			t.Errorf("%s: config serves wrong certificate", tc.name)
+		}
+		if cert, _ := r.GetCertificate(chi); cert != tc.cert {
+			t.Errorf("%s: GetCertificate returns wrong certificate", tc.name)
+		}
+	}
+	if config, _ := r.GetConfigForClient(nil); config.MinVersion != tls.VersionTLS13 {
+		t.Error("base config modified")
+	}
+
+	r.SetServerNameConfig("legacy.example", nil, nil)
+	if config, _ := r.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "legacy.example"}); config.MinVersion != tls.VersionTLS13 {
+		t.Error("removed override still applies")
+	}
+}
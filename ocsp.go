@@ -0,0 +1,177 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPStatus describes the OCSP response stapled to loaded certificate.
+type OCSPStatus struct {
+	// Status is one of ocsp.Good, ocsp.Revoked or ocsp.Unknown.
+	Status     int
+	ProducedAt time.Time
+	ThisUpdate time.Time
+	// NextUpdate is zero if the responder did not set it.
+	NextUpdate time.Time
+	// RevokedAt is only set if Status is ocsp.Revoked.
+	RevokedAt time.Time
+}
+
+// Expired reports whether the response is past its NextUpdate at time t.
+func (s *OCSPStatus) Expired(t time.Time) bool {
+	return !s.NextUpdate.IsZero() && t.After(s.NextUpdate)
+}
+
+var errNoStaple = errors.New("no OCSP staple loaded")
+
+// OCSPStatus parses the OCSP response stapled to currently loaded certificate.
+func (r *Reloader) OCSPStatus() (*OCSPStatus, error) {
+	snap := r.snapshot()
+	if snap == nil || len(snap.cert.OCSPStaple) == 0 {
+		return nil, errNoStaple
+	}
+	resp, err := parseStaple(snap.cert, snap.ocspIssuer)
+	if err != nil {
+		return nil, err
+	}
+	return newOCSPStatus(resp), nil
+}
+
+func newOCSPStatus(resp *ocsp.Response) *OCSPStatus {
+	s := &OCSPStatus{
+		Status:     resp.Status,
+		ProducedAt: resp.ProducedAt,
+		ThisUpdate: resp.ThisUpdate,
+		NextUpdate: resp.NextUpdate,
+	}
+	if resp.Status == ocsp.Revoked {
+		s.RevokedAt = resp.RevokedAt
+	}
+	return s
+}
+
+// parseStaple parses cert.OCSPStaple for cert.Leaf. The signature is verified
+// if the issuer is available in the chain, or otherwise given as hint.
+func parseStaple(cert *tls.Certificate, hint *x509.Certificate) (*ocsp.Response, error) {
+	issuer := hint
+	if len(cert.Certificate) > 1 {
+		var err error
+		if issuer, err = x509.ParseCertificate(cert.Certificate[1]); err != nil {
+			return nil, err
+		}
+	}
+	return ocsp.ParseResponseForCert(cert.OCSPStaple, cert.Leaf, issuer)
+}
+
+// parseIssuerHint parses the certificate given to WithOCSPIssuerFile, either
+// PEM or DER encoded.
+func parseIssuerHint(data []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block %s in OCSP issuer", block.Type)
+		}
+		data = block.Bytes
+	}
+	return x509.ParseCertificate(data)
+}
+
+// checkStaple validates the staple attached to a newly loaded cert. An
+// unusable staple is removed from cert. Problems are returned as warnings and
+// never prevent cert from being installed. Expiry is checked as of now.
+func checkStaple(cert *tls.Certificate, hint *x509.Certificate, now time.Time) (warnings []error) {
+	if len(cert.OCSPStaple) == 0 {
+		return
+	}
+	resp, err := parseStaple(cert, hint)
+	if err != nil {
+		cert.OCSPStaple = nil
+		return []error{fmt.Errorf("dropped OCSP staple: %v", err)}
+	}
+	switch resp.Status {
+	case ocsp.Revoked:
+		warnings = append(warnings, fmt.Errorf("OCSP staple indicates certificate was revoked at %s", resp.RevokedAt.Format(time.RFC3339)))
+	case ocsp.Unknown:
+		warnings = append(warnings, errors.New("OCSP staple indicates certificate status is unknown"))
+	}
+	if newOCSPStatus(resp).Expired(now) {
+		warnings = append(warnings, fmt.Errorf("OCSP staple expired at %s", resp.NextUpdate.Format(time.RFC3339)))
+	}
+	return
+}
+
+// refreshStaples fetches staples by the function of WithOCSPFetcher every
+// interval and whenever a new certificate was installed, until r is stopped.
+func (r *Reloader) refreshStaples(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.fetchStaple()
+		select {
+		case <-r.chStop:
+			return
+		case <-ticker.C:
+		case <-r.stapleNow:
+		}
+	}
+}
+
+// fetchStaple fetches a staple for the loaded certificate, and installs it
+// along with the certificate unless that was replaced meanwhile. Failures,
+// including a panic of the fetcher, are reported like those of background
+// reloads, keeping the current staple.
+func (r *Reloader) fetchStaple() {
+	defer r.recoverTick()
+	snap := r.snapshot()
+	if snap == nil || snap.cert.Leaf == nil {
+		return
+	}
+	issuer := snap.ocspIssuer
+	if len(snap.cert.Certificate) > 1 {
+		var err error
+		if issuer, err = x509.ParseCertificate(snap.cert.Certificate[1]); err != nil {
+			r.reportError(reasonReadFailed, fmt.Errorf("fetching OCSP staple: %w", err))
+			return
+		}
+	}
+	staple, err := r.stapleFetch(issuer, snap.cert.Leaf.SerialNumber)
+	if err != nil {
+		r.reportError(reasonReadFailed, fmt.Errorf("fetching OCSP staple: %w", err))
+		return
+	}
+	if bytes.Equal(staple, snap.cert.OCSPStaple) {
+		return
+	}
+	cert := *snap.cert
+	cert.OCSPStaple = staple
+	warnings := checkStaple(&cert, snap.ocspIssuer, r.now())
+	r.warn(warnings...)
+	if cert.OCSPStaple == nil {
+		return // dropped, keep the current one
+	}
+
+	r.mu.Lock()
+	if r.snapshot() != snap {
+		r.mu.Unlock()
+		return
+	}
+	next := *snap
+	next.cert = &cert
+	next.config = r.newConfig(&next)
+	atomic.StorePointer(
+		(*unsafe.Pointer)(unsafe.Pointer(&r.snap)),
+		unsafe.Pointer(&next),
+	)
+	r.mu.Unlock()
+	if !r.certOnly {
+		r.updateBound(next.certificates())
+	}
+}
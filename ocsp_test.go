@@ -0,0 +1,272 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestOCSPIssuerFile(t *testing.T) {
+	dir := t.TempDir()
+	caPEM, ca, caKey := issueTestCert(t, "ca", true, nil, nil)
+	otherPEM, _, _ := issueTestCert(t, "other", true, nil, nil)
+	leafPEM, leaf, leafKey := issueTestCert(t, "example", false, ca, caKey)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staple, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: new(big.Int).Set(leaf.SerialNumber),
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	staplePath := filepath.Join(dir, "staple.der")
+	issuerPath := filepath.Join(dir, "issuer.pem")
+	writeTestFile(t, certPath, leafPEM) // without intermediate
+	writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	writeTestFile(t, staplePath, staple)
+	writeTestFile(t, issuerPath, caPEM)
+
+	var warnings []error
+	r, err := New(certPath, keyPath, time.Hour, WithOCSPStapleFile(staplePath), WithOCSPIssuerFile(issuerPath),
+		WithOnWarning(func(err error) { warnings = append(warnings, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if status, err := r.OCSPStatus(); err != nil || status.Status != ocsp.Good {
+		t.Fatalf("got %+v, %v, want good status", status, err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("got %v", warnings)
+	}
+
+	// The staple does not verify against another issuer.
+	writeTestFile(t, issuerPath, otherPEM)
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v, want reload for changed issuer", res, err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("got %v, want staple dropped", warnings)
+	}
+	if _, err := r.OCSPStatus(); err != errNoStaple {
+		t.Errorf("got %v, want %v", err, errNoStaple)
+	}
+}
+
+func TestOCSPIssuerFileOnly(t *testing.T) {
+	dir := t.TempDir()
+	caPEM, ca, caKey := issueTestCert(t, "ca", true, nil, nil)
+	otherPEM, _, _ := issueTestCert(t, "other", true, nil, nil)
+	leafPEM, _, leafKey := issueTestCert(t, "example", false, ca, caKey)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	issuerPath := filepath.Join(dir, "issuer.pem")
+	writeTestFile(t, certPath, leafPEM) // without intermediate
+	writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	writeTestFile(t, issuerPath, otherPEM)
+
+	fetch := func(*x509.Certificate, *big.Int) ([]byte, error) { return nil, errors.New("unavailable") }
+	r, err := New(certPath, keyPath, time.Hour, WithOCSPFetcher(fetch, time.Hour), WithOCSPIssuerFile(issuerPath),
+		WithOnError(func(error) {}), WithOnWarning(func(error) {}), withRacyWindow(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.Reload() // record settled stamps
+
+	// Rewriting only the issuer file is picked up, although certificate and
+	// private key keep their stamps.
+	writeTestFile(t, issuerPath, caPEM)
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v, want reload for changed issuer", res, err)
+	}
+}
+
+func TestOCSPFetcher(t *testing.T) {
+	dir := t.TempDir()
+	caPEM, ca, caKey := issueTestCert(t, "ca", true, nil, nil)
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	writeLeaf := func() *x509.Certificate {
+		leafPEM, leaf, leafKey := issueTestCert(t, "example", false, ca, caKey)
+		keyDER, err := x509.MarshalPKCS8PrivateKey(leafKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, certPath, append(leafPEM, caPEM...))
+		writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+		return leaf
+	}
+	leaf := writeLeaf()
+
+	var fail, panics atomic.Bool
+	fetch := func(issuer *x509.Certificate, serial *big.Int) ([]byte, error) {
+		if panics.Load() {
+			panic("buggy fetcher")
+		}
+		if !issuer.Equal(ca) {
+			t.Errorf("got issuer %s", issuer.Subject)
+		}
+		if fail.Load() {
+			return nil, errors.New("cache unavailable")
+		}
+		return ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: serial,
+			ThisUpdate:   time.Now().Add(-time.Hour),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}, caKey)
+	}
+	errs := make(chan error, 10)
+	r, err := New(certPath, keyPath, time.Hour, WithOCSPFetcher(fetch, time.Hour),
+		WithOnError(func(err error) { errs <- err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	waitStaple := func(serial *big.Int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if resp, err := ocsp.ParseResponse(r.Get().OCSPStaple, nil); err == nil && resp.SerialNumber.Cmp(serial) == 0 {
+				return
+			}
+		}
+		t.Fatalf("no staple for serial %v installed", serial)
+	}
+	waitStaple(leaf.SerialNumber)
+	if status, err := r.OCSPStatus(); err != nil || status.Status != ocsp.Good {
+		t.Fatalf("got %+v, %v, want good status", status, err)
+	}
+
+	// A new certificate is stapled right away.
+	leaf = writeLeaf()
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+	waitStaple(leaf.SerialNumber)
+
+	// A failed fetch is reported, keeping the staple.
+	fail.Store(true)
+	old := r.Get().OCSPStaple
+	r.fetchStaple()
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "cache unavailable") {
+			t.Errorf("got %v", err)
+		}
+	default:
+		t.Error("failed fetch not reported")
+	}
+	if !bytes.Equal(r.Get().OCSPStaple, old) {
+		t.Error("failed fetch dropped staple")
+	}
+
+	// So is a panicking fetcher, without crashing.
+	panics.Store(true)
+	r.fetchStaple()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, errPanic) {
+			t.Errorf("got %v, want %v", err, errPanic)
+		}
+	default:
+		t.Error("panicking fetch not reported")
+	}
+	if !bytes.Equal(r.Get().OCSPStaple, old) {
+		t.Error("panicking fetch dropped staple")
+	}
+}
+
+func TestOCSPStatus(t *testing.T) {
+	dir := t.TempDir()
+	caPEM, ca, caKey := issueTestCert(t, "ca", true, nil, nil)
+	leafPEM, leaf, leafKey := issueTestCert(t, "example", false, ca, caKey)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	staplePath := filepath.Join(dir, "staple.der")
+	writeTestFile(t, certPath, append(leafPEM, caPEM...))
+	writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+
+	now := time.Now().Truncate(time.Second)
+	revokedAt := now.Add(-30 * time.Minute)
+	for _, tc := range []struct {
+		name       string
+		status     int
+		nextUpdate time.Time
+		warning    string // expected warning, if any
+	}{
+		{"good", ocsp.Good, now.Add(time.Hour), ""},
+		{"revoked", ocsp.Revoked, now.Add(time.Hour), "revoked"},
+		{"unknown", ocsp.Unknown, now.Add(time.Hour), "unknown"},
+		{"expired", ocsp.Good, now.Add(-time.Minute), "expired"},
+		{"no next update", ocsp.Good, time.Time{}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			staple, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+				Status:           tc.status,
+				SerialNumber:     leaf.SerialNumber,
+				ThisUpdate:       now.Add(-time.Hour),
+				NextUpdate:       tc.nextUpdate,
+				RevokedAt:        revokedAt,
+				RevocationReason: ocsp.KeyCompromise,
+			}, caKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, staplePath, staple)
+			var warnings []error
+			r, err := New(certPath, keyPath, time.Hour, WithOCSPStapleFile(staplePath),
+				WithOnWarning(func(err error) { warnings = append(warnings, err) }))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+
+			status, err := r.OCSPStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Status != tc.status || !status.ThisUpdate.Equal(now.Add(-time.Hour)) || !status.NextUpdate.Equal(tc.nextUpdate) {
+				t.Errorf("got %+v", status)
+			}
+			if wantRevoked := tc.status == ocsp.Revoked; wantRevoked != !status.RevokedAt.IsZero() ||
+				wantRevoked && !status.RevokedAt.Equal(revokedAt) {
+				t.Errorf("got revocation time %v", status.RevokedAt)
+			}
+			if status.Expired(now) != (tc.warning == "expired") {
+				t.Errorf("got Expired %v", status.Expired(now))
+			}
+			if tc.warning == "" && len(warnings) != 0 ||
+				tc.warning != "" && (len(warnings) != 1 || !strings.Contains(warnings[0].Error(), tc.warning)) {
+				t.Errorf("got warnings %v, want %q", warnings, tc.warning)
+			}
+			if len(r.Get().OCSPStaple) == 0 {
+				t.Error("staple dropped")
+			}
+		})
+	}
+}
@@ -0,0 +1,562 @@
+package certreloader
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"hash"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Option configures optional behavior of a Reloader.
+type Option func(*Reloader)
+
+// WithStrictExpiry makes GetCertificate fail the handshake instead of serving
+// an expired certificate, once grace has elapsed since its NotAfter and no
+// valid replacement has been loaded. By default an expired certificate is
+// served indefinitely.
+func WithStrictExpiry(grace time.Duration) Option {
+	return func(r *Reloader) {
+		r.strictExpiry = true
+		r.expiryGrace = grace
+	}
+}
+
+// WithExpiredFallback sets an emergency certificate, e.g. a self-signed one,
+// served instead of the loaded certificate once that expired and no valid
+// replacement has been loaded. It takes precedence over WithStrictExpiry. The
+// Leaf of cert is parsed by New if nil, failing if the certificate is
+// malformed.
+func WithExpiredFallback(cert *tls.Certificate) Option {
+	return func(r *Reloader) {
+		r.fallback = cert
+	}
+}
+
+// WithOnReload sets a function to be called after a reload installed a new
+// certificate. It is called once the reload released the lock of r, so it may
+// call methods such as Reload. See also SetOnReload.
+func WithOnReload(fn func(*tls.Certificate)) Option {
+	return func(r *Reloader) {
+		r.SetOnReload(fn)
+	}
+}
+
+// WithOnError sets a function to be called when a reload failed, instead of
+// logging the error. See also SetOnError.
+func WithOnError(fn func(error)) Option {
+	return func(r *Reloader) {
+		r.SetOnError(fn)
+	}
+}
+
+// WithOnRecover sets a function to be called on the first successful reload
+// after a failure streak, with the last error. The recovery is logged as
+// well. See also SetOnRecover.
+func WithOnRecover(fn func(error)) Option {
+	return func(r *Reloader) {
+		r.SetOnRecover(fn)
+	}
+}
+
+// WithObserver sets a function to be called with details of every reload
+// attempt, including the initial load. See also SetObserver.
+func WithObserver(fn func(ReloadInfo)) Option {
+	return func(r *Reloader) {
+		r.SetObserver(fn)
+	}
+}
+
+// WithHistorySize changes how many recent reload attempts are kept for
+// History from 16 to n. A non-positive n disables history.
+func WithHistorySize(n int) Option {
+	return func(r *Reloader) {
+		r.historySize = n
+	}
+}
+
+// WithStaleAfter sets how long Healthy tolerates no successful reload before
+// reporting the reloader as unhealthy. It defaults to 3 reload intervals.
+func WithStaleAfter(d time.Duration) Option {
+	return func(r *Reloader) {
+		r.staleAfter = d
+	}
+}
+
+// WithOCSPStapleFile sets a file containing a DER encoded OCSP response to be
+// stapled to the certificate. It is reloaded along with the certificate. A
+// staple that does not parse or does not belong to the certificate is dropped
+// with a warning; a revoked or expired one is kept but also warned about.
+func WithOCSPStapleFile(path string) Option {
+	return func(r *Reloader) {
+		r.stapleSrc = pathSource(path)
+	}
+}
+
+// WithOCSPIssuerFile sets a file containing the issuer certificate, PEM or
+// DER encoded, for verifying the staple of WithOCSPStapleFile or
+// WithOCSPFetcher when the certificate file lacks intermediates, e.g. when
+// only the leaf is served. It is reloaded independently along with the
+// certificate. The chain takes precedence if it includes the issuer. An
+// unusable file is warned about and ignored. Without either of those options,
+// it is not read at all.
+func WithOCSPIssuerFile(path string) Option {
+	return func(r *Reloader) {
+		r.issuerSrc = pathSource(path)
+	}
+}
+
+// WithOCSPFetcher sets a function fetching a DER encoded OCSP response for the
+// certificate of serial issued by issuer, e.g. from a cache shared by a fleet
+// instead of querying the responder from each node. issuer is taken from the
+// chain, or WithOCSPIssuerFile, and is nil if neither has it. It is called in
+// background once started, every interval, and as soon as a new certificate
+// was installed. A fetched staple replaces that of WithOCSPStapleFile, and is
+// dropped or warned about like one. If fetching fails, the failure is reported
+// like that of a reload and the current staple is kept. A non-positive
+// interval means the reload interval.
+func WithOCSPFetcher(fetch func(issuer *x509.Certificate, serial *big.Int) ([]byte, error), interval time.Duration) Option {
+	return func(r *Reloader) {
+		r.stapleFetch = fetch
+		r.stapleEvery = interval
+	}
+}
+
+// WithOnWarning sets a function to be called for problems which do not prevent
+// a certificate from being used, instead of logging them. See also
+// SetOnWarning.
+func WithOnWarning(fn func(error)) Option {
+	return func(r *Reloader) {
+		r.SetOnWarning(fn)
+	}
+}
+
+// WithFileWatch makes the Reloader also watch certificate / private key files
+// for changes, in addition to periodic reloading. A reload is attempted once
+// no further change was observed for the settle period, so that writing both
+// files results in a single reload. It is only supported by New.
+func WithFileWatch(settle time.Duration) Option {
+	return func(r *Reloader) {
+		r.watchSettle = settle
+	}
+}
+
+// WithKeyPolicy rejects certificates whose public key does not satisfy p, e.g.
+// to prevent a weak key from going live.
+func WithKeyPolicy(p KeyPolicy) Option {
+	return func(r *Reloader) {
+		r.keyPolicy = &p
+	}
+}
+
+// WithParsePolicy rejects leaf certificates violating p, giving control over
+// what is served independent of the Go version.
+func WithParsePolicy(p ParsePolicy) Option {
+	return func(r *Reloader) {
+		r.parsePolicy = &p
+	}
+}
+
+// WithPreParseHook sets a function to be called with changed certificate /
+// private key PEM before they are parsed, e.g. to verify a detached signature
+// or an allowlisted digest. A non-nil error rejects them, keeping the
+// previously loaded certificate, and is reported like other reload failures.
+// It runs while the reload holds the lock of r, so calling methods such as
+// Reload, Pin or Reconfigure from it deadlocks.
+func WithPreParseHook(fn func(certPEM, keyPEM []byte) error) Option {
+	return func(r *Reloader) {
+		r.preParse = fn
+	}
+}
+
+// WithBase64DERKey reads private key files as base64 encoded PKCS #8 DER
+// without PEM armor, as written by some secret stores, while the certificate
+// is still read as PEM. Each key is wrapped into a PEM PRIVATE KEY block
+// before it is paired, so hooks such as WithPreParseHook see PEM. Whitespace
+// in key files is ignored.
+func WithBase64DERKey() Option {
+	return func(r *Reloader) {
+		r.base64Key = true
+	}
+}
+
+// WithRelativePaths keeps paths given to New verbatim instead of converting
+// them to absolute form, so that they are resolved against the working
+// directory (and root) at the time of each reload. This is useful if the
+// process changes its root after New.
+func WithRelativePaths() Option {
+	return func(r *Reloader) {
+		r.relativePaths = true
+	}
+}
+
+// WithDebugLogger makes each background reload emit one line at debug level
+// to l, describing whether it was skipped, installed a new certificate or was
+// rejected and why. It is disabled by default.
+func WithDebugLogger(l *slog.Logger) Option {
+	return func(r *Reloader) {
+		r.debugLog = l
+	}
+}
+
+// WithClientCAFile sets a PEM bundle of CA certificates trusted for client
+// authentication. It is reloaded in the same pass as certificate / private
+// key, and a change of any of them installs all of them at once. A bundle
+// without any certificate rejects the reload. See GetConfigForClient.
+func WithClientCAFile(path string) Option {
+	return func(r *Reloader) {
+		r.caSrc = pathSource(path)
+	}
+}
+
+// WithBaseConfig sets the tls.Config from which configs returned by
+// GetConfigForClient are derived, e.g. to require client certificates. It is
+// cloned on each reload and must not be modified afterwards.
+func WithBaseConfig(config *tls.Config) Option {
+	return func(r *Reloader) {
+		r.baseConfig = config
+	}
+}
+
+// WithWatchEvents selects file system events which trigger a reload when
+// WithFileWatch is given. It defaults to DefaultWatchEvents. Including
+// WatchChmod makes permission changes trigger reloads as well, which are
+// usually spurious.
+func WithWatchEvents(events WatchEvent) Option {
+	return func(r *Reloader) {
+		r.watchEvents = events
+	}
+}
+
+// WithStartupSummary makes New log a line describing the initially loaded
+// certificate: subject, SANs, issuer, serial, validity and SHA-256 fingerprint.
+func WithStartupSummary() Option {
+	return func(r *Reloader) {
+		r.startupSummary = true
+	}
+}
+
+// WithTLSPreset selects the preset applied by TLSConfig. It defaults to
+// PresetNone.
+func WithTLSPreset(p Preset) Option {
+	return func(r *Reloader) {
+		r.preset = p
+	}
+}
+
+// WithWatchMinInterval limits reloads triggered by file watching to at most
+// one per d, protecting against a writer rewriting files in a tight loop.
+// Excess triggers are delayed rather than dropped, so that the final contents
+// are always picked up. Periodic reloading is not affected.
+func WithWatchMinInterval(d time.Duration) Option {
+	return func(r *Reloader) {
+		r.watchMinInterval = d
+	}
+}
+
+// WithTriggerFile gates reloading on changes of a trigger file, e.g. touched
+// by a deploy tool after writing all other files. Certificate / private key
+// are read only when the trigger file was modified or touched since the last
+// successful reload, and only the trigger file is watched if WithFileWatch is
+// given. A missing trigger file is treated as unchanged.
+func WithTriggerFile(path string) Option {
+	return func(r *Reloader) {
+		r.triggerSrc = pathSource(path)
+	}
+}
+
+// WithDryRun makes reloads after the initial one perform all reading, parsing
+// and validation without ever installing anything, e.g. to observe the effect
+// of a new validation policy before enforcing it. Would-be installations are
+// logged and reported as ReloadResult with Changed false, on every reload as
+// long as the files differ from the initially loaded ones, while rejections
+// are reported as usual. Get keeps returning the initially loaded certificate.
+func WithDryRun() Option {
+	return func(r *Reloader) {
+		r.dryRun = true
+	}
+}
+
+// WithKeyPassphraseFile sets a file containing the passphrase of an encrypted
+// private key, ignoring trailing newline. Supported is ENCRYPTED PRIVATE KEY
+// using PBES2 with PBKDF2 and AES-CBC, which is the default of OpenSSL. The
+// passphrase is read on each reload, and a change of it alone is enough to
+// reload, so that it can be rotated along with the key. Buffers holding it are
+// zeroed after use, best effort.
+//
+// Deprecated support remains for legacy PEM encryption (Proc-Type:
+// 4,ENCRYPTED), which is insecure by design as explained for
+// x509.DecryptPEMBlock; convert such keys with `openssl pkcs8 -topk8`.
+func WithKeyPassphraseFile(path string) Option {
+	return func(r *Reloader) {
+		r.passSrc = pathSource(path)
+	}
+}
+
+// WithSCTCheck checks on each reload that the leaf certificate embeds signed
+// certificate timestamps (the extension 1.3.6.1.4.1.11129.2.4.2), i.e. that it
+// was logged to Certificate Transparency. The timestamps are not verified.
+func WithSCTCheck(e Enforcement) Option {
+	return func(r *Reloader) {
+		r.sctPolicy = e
+	}
+}
+
+// WithReloadGuard sets a function consulted at the start of each background
+// reload; if it returns false, the reload is skipped without reading any file,
+// e.g. during a deploy freeze. Skipped reloads count as successful ones for
+// Healthy. It runs on the reloading goroutine and should be cheap. Explicit
+// Reload calls are not affected.
+func WithReloadGuard(fn func() bool) Option {
+	return func(r *Reloader) {
+		r.guard = fn
+	}
+}
+
+// WithMaxFileSize limits the size of each file read on reload, such as
+// certificate and private key. A reload reading a larger file fails, keeping
+// the previously loaded certificate; at most n+1 bytes of it are buffered. A
+// non-positive n means no limit, which is the default.
+func WithMaxFileSize(n int64) Option {
+	return func(r *Reloader) {
+		r.maxFileSize = n
+	}
+}
+
+// WithReloadTimeout aborts a reload still reading files after d, failing it
+// like an unreadable file and keeping the previously loaded certificate, e.g.
+// when a network file system hangs. The initial load in New, as well as
+// explicit calls like Reload and SelfTest, are included. Stop aborts an
+// in-flight background reload regardless, but not explicit ones. A
+// non-positive d means no timeout, which is the default.
+func WithReloadTimeout(d time.Duration) Option {
+	return func(r *Reloader) {
+		r.reloadTimeout = d
+	}
+}
+
+// WithMaxChainLength rejects certificate chains of more than n certificates,
+// including the leaf. A non-positive n means no limit, which is the default.
+func WithMaxChainLength(n int) Option {
+	return func(r *Reloader) {
+		r.maxChainLen = n
+	}
+}
+
+// WithRotationWarning emits a warning on every periodic reload once no new
+// certificate was installed for longer than d, whether files changed or not,
+// e.g. 60 days for certificates renewed every 30 days. It catches a broken
+// renewal long before the certificate expires. The time is taken from the
+// clock set by WithClock. A non-positive d disables it, which is the default.
+func WithRotationWarning(d time.Duration) Option {
+	return func(r *Reloader) {
+		r.rotationWarn = d
+	}
+}
+
+// WithRootsCheck verifies the currently loaded chain against roots on every
+// periodic reload, whether files changed or not, and emits a warning while it
+// does not verify, e.g. because an intermediate was distrusted or expired. A
+// nil roots means the system pool; note that crypto/x509 loads it only once
+// per process on some platforms, while others consult the platform verifier
+// each time.
+func WithRootsCheck(roots *x509.CertPool) Option {
+	return func(r *Reloader) {
+		r.checkTrust = true
+		r.roots = roots
+	}
+}
+
+// WithVeto sets a function called on reload with the leaf of currently loaded
+// certificate and that of a new, otherwise acceptable one, before installing
+// it. A non-nil error vetoes the rotation, keeping the old certificate, and is
+// reported like other reload failures; e.g. to require that SANs never
+// shrink, or that the issuer stays the same. It is not called for the initial
+// load. It runs while the reload holds the lock of r, so calling methods such
+// as Reload, Pin or Reconfigure from it deadlocks.
+func WithVeto(fn func(old, new *x509.Certificate) error) Option {
+	return func(r *Reloader) {
+		r.veto = fn
+	}
+}
+
+// WithIncompleteRetry retries a background reload after d, instead of waiting
+// for the next periodic one, if it failed with ErrIncompleteFile, so that a
+// rewritten file is picked up shortly. At most one retry is pending at a time,
+// and it is canceled by the next successful reload. By default there is no
+// retry.
+func WithIncompleteRetry(d time.Duration) Option {
+	return func(r *Reloader) {
+		r.incompleteRetry = d
+	}
+}
+
+// WithChainFiles assembles the served chain from the certificate file
+// followed by the certificates of paths in order, e.g. a leaf and separate
+// intermediate files. All of them are reloaded in the same pass. The assembled
+// chain must be ordered so that each certificate is signed by the next one,
+// otherwise the reload is rejected.
+func WithChainFiles(paths ...string) Option {
+	return func(r *Reloader) {
+		r.chainSrcs = nil
+		for _, p := range paths {
+			r.chainSrcs = append(r.chainSrcs, pathSource(p))
+		}
+	}
+}
+
+// WithParseCache shares parsed certificates through c with other Reloaders
+// given the same c, see ParseCache. Only Reloaders reading the same files with
+// the same parsing options and policies share a parse. Callbacks still apply
+// to each Reloader separately.
+func WithParseCache(c *ParseCache) Option {
+	return func(r *Reloader) {
+		r.parseCache = c
+	}
+}
+
+// WithRareKeyChanges avoids reading and hashing a private key which rarely
+// changes on every reload: as long as the certificate is unchanged, the key
+// is read only on every n-th reload, so that a change of the key alone is
+// picked up within n reloads. It is always read if the certificate or any
+// other file changed. Values of n below 2 read the key on every reload, which
+// is the default.
+func WithRareKeyChanges(n int) Option {
+	return func(r *Reloader) {
+		r.keyEvery = n
+	}
+}
+
+// WithFixedKey loads the private key only once in New, e.g. when it is held
+// by an HSM or never rotated, and keeps using it: later reloads read the
+// certificate only, and pair it with the fixed key, so that the key is
+// neither read, hashed nor parsed again. A certificate not matching the key
+// fails the reload with ErrKeyMismatch, keeping the previous one. On those
+// reloads, WithPreParseHook is called with a nil key. It cannot be combined
+// with certificate-only mode or NewFromBundle.
+func WithFixedKey() Option {
+	return func(r *Reloader) {
+		r.keyOnce = true
+	}
+}
+
+// WithChangeComparator replaces the check whether certificate / private key
+// changed since last successful reload, e.g. to ignore cosmetic rewrites by a
+// pipeline. changed receives the contents installed by last successful reload
+// and those just read, where candidate keys of NewWithKeys are concatenated,
+// and reports whether to reload. Only files read on each reload are compared;
+// stamps of unchanged files still skip reading as described for New, and
+// changes of other files, such as WithChainFiles, always reload. It requires
+// keeping a copy of the private key in memory, and disables
+// WithRareKeyChanges.
+func WithChangeComparator(changed func(oldCert, oldKey, newCert, newKey []byte) bool) Option {
+	return func(r *Reloader) {
+		r.compare = changed
+	}
+}
+
+// WithSwapWindow delays installing a new certificate until the loaded one is
+// within d of its expiry, so that both stay valid for as long as possible,
+// e.g. for long-lived connections pinning the old one. Until then, reloads
+// finding new files succeed without installing them, reading and validating
+// them again each time; a renewal arriving later than d before expiry is
+// installed right away. Since swapping happens on a reload, d should
+// comfortably exceed the reload interval, and renewal of files should be
+// scheduled earlier than d before expiry. It does not apply to the initial
+// load, nor to an already expired certificate, which WithExpiredFallback and
+// WithStrictExpiry take care of in the meantime.
+func WithSwapWindow(d time.Duration) Option {
+	return func(r *Reloader) {
+		r.swapWindow = d
+	}
+}
+
+// WithInitialDelay schedules the first periodic reload d after start, instead
+// of a full interval, so that files changed right after New are picked up
+// sooner. Later reloads follow every interval from the first one. A
+// non-positive d keeps the default.
+func WithInitialDelay(d time.Duration) Option {
+	return func(r *Reloader) {
+		r.initialDelay = d
+	}
+}
+
+// WithManualStart defers periodic reloading, file watching and receiving of
+// frames by NewFromFIFO until Start is called, e.g. until dependencies are
+// ready. The initial load still happens in New, and Reload works before Start.
+func WithManualStart() Option {
+	return func(r *Reloader) {
+		r.manualStart = true
+	}
+}
+
+// WithPinnedFingerprints rejects any leaf certificate whose SHA-256
+// fingerprint (of DER, in hex, optionally separated by colons), or that by the
+// hash given to WithFingerprintHash, is not one of fps, failing with
+// ErrFingerprintMismatch and keeping the previously loaded certificate, so
+// that only sanctioned certificates are ever served. List both old and new
+// fingerprint during a planned rotation.
+func WithPinnedFingerprints(fps ...string) Option {
+	return func(r *Reloader) {
+		r.pins = make(map[string]bool, len(fps))
+		for _, fp := range fps {
+			r.pins[strings.ToLower(strings.ReplaceAll(fp, ":", ""))] = true
+		}
+	}
+}
+
+// WithAllowedIssuers rejects any leaf certificate whose issuer is not listed,
+// keeping the previously loaded certificate, e.g. to never serve a certificate
+// mistakenly or maliciously obtained from another CA. Each of issuers is
+// either a distinguished name in the form of pkix.Name.String, e.g.
+// "CN=R3,O=Let's Encrypt,C=US", or the SHA-256 fingerprint of the issuer's
+// public key (of DER encoded SubjectPublicKeyInfo, in hex, optionally
+// separated by colons). The latter requires the issuer to be the second
+// certificate of the chain. Both kinds may be mixed.
+func WithAllowedIssuers(issuers ...string) Option {
+	return func(r *Reloader) {
+		r.issuers = make(map[string]bool, len(issuers))
+		for _, issuer := range issuers {
+			if !strings.Contains(issuer, "=") {
+				issuer = strings.ToLower(strings.ReplaceAll(issuer, ":", ""))
+			}
+			r.issuers[issuer] = true
+		}
+	}
+}
+
+// WithChangeHash replaces xxHash for computing digests of files, by which a
+// change is detected. Only files edited in between are told apart, and the
+// digest is never used to identify a certificate, so a fast non-cryptographic
+// hash such as FNV suffices and the choice does not affect security.
+func WithChangeHash(fn func() hash.Hash64) Option {
+	return func(r *Reloader) {
+		r.changeHash = fn
+	}
+}
+
+// WithFingerprintHash replaces SHA-256 for fingerprints identifying leaf
+// certificates, i.e. those of WithPinnedFingerprints and ReloadInfo, e.g. where
+// another algorithm is mandated. New fails if h is not linked into the binary.
+// Log messages and WithAllowedIssuers keep using SHA-256.
+func WithFingerprintHash(h crypto.Hash) Option {
+	return func(r *Reloader) {
+		r.fpHash = h
+	}
+}
+
+// WithClock replaces time.Now for all time-based decisions and timestamps,
+// e.g. in tests, so that they consistently follow the same clock: expiry as of
+// WithStrictExpiry, WithExpiredFallback and TimeToExpiry, WithSwapWindow,
+// WithRotationWarning, staleness reported by Healthy, expiry of OCSP staples,
+// verification of WithRootsCheck, and the times of ReloadInfo and Stats.
+// Scheduling of periodic reloads and file watching, as well as ReloadInfo
+// durations, still follow real time.
+func WithClock(now func() time.Time) Option {
+	return func(r *Reloader) {
+		r.clock = now
+	}
+}
@@ -0,0 +1,76 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errInvalidPair = errors.New("invalid certificate / private key path of additional pair")
+
+// pairSpec is a pair given to WithAdditionalPair.
+type pairSpec struct {
+	certPath string
+	keyPath  string
+	opts     []Option
+}
+
+// WithAdditionalPair serves another certificate / private key pair besides
+// the one given to New, e.g. an RSA pair for clients not supporting the
+// primary ECDSA one. The pair is reloaded like New does on its own schedule
+// with the same interval, taking opts, so that a failure of either pair never
+// affects the other one. GetCertificate selects the first pair, the primary
+// one first, whose certificate is supported by the client in terms of
+// signature schemes, cipher suites, curves and server name (see
+// tls.ClientHelloInfo.SupportsCertificate), and falls back to the primary one.
+// Get, Leaf, Bind, GetConfigForClient and the like refer to the primary pair
+// only. The initial load of each pair must succeed, or construction fails.
+func WithAdditionalPair(certPath, keyPath string, opts ...Option) Option {
+	return func(r *Reloader) {
+		r.pairSpecs = append(r.pairSpecs, pairSpec{certPath, keyPath, opts})
+	}
+}
+
+// newPairs creates Reloaders for r.pairSpecs, which are started along with r.
+func (r *Reloader) newPairs(interval time.Duration) error {
+	for _, spec := range r.pairSpecs {
+		if spec.certPath == "" || spec.keyPath == "" {
+			r.stopPairs()
+			return errInvalidPair
+		}
+		opts := spec.opts
+		if r.relativePaths {
+			opts = append([]Option{WithRelativePaths()}, opts...)
+		}
+		opts = append(opts, WithManualStart())
+		p, err := New(spec.certPath, spec.keyPath, interval, opts...)
+		if err != nil {
+			r.stopPairs()
+			return fmt.Errorf("additional pair %s: %w", spec.certPath, err)
+		}
+		r.pairs = append(r.pairs, p)
+	}
+	return nil
+}
+
+func (r *Reloader) stopPairs() {
+	for _, p := range r.pairs {
+		p.Stop()
+	}
+}
+
+// selectPair returns the certificate to serve chi along with the Reloader it
+// belongs to, considering pairs of NewFromBundle and WithAdditionalPair.
+func (r *Reloader) selectPair(chi *tls.ClientHelloInfo) (*Reloader, *tls.Certificate) {
+	cert := r.snapshot().selectCertificate(chi)
+	if len(r.pairs) == 0 || chi == nil || chi.SupportsCertificate(cert) == nil {
+		return r, cert
+	}
+	for _, p := range r.pairs {
+		if c := p.current(); chi.SupportsCertificate(c) == nil {
+			return p, c
+		}
+	}
+	return r, cert
+}
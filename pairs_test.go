@@ -0,0 +1,94 @@
+package certreloader
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestRSAPair writes an RSA certificate / private key for cn into dir.
+func writeTestRSAPair(t *testing.T, dir, cn string) (certPath, keyPath string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath = filepath.Join(dir, "rsa-cert.pem")
+	keyPath = filepath.Join(dir, "rsa-key.pem")
+	writeTestFile(t, certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return
+}
+
+func TestAdditionalPair(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	rsaCertPath, rsaKeyPath := writeTestRSAPair(t, dir, "rsa")
+	r, err := New(certPath, keyPath, time.Hour, WithAdditionalPair(rsaCertPath, rsaKeyPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	get := func(scheme tls.SignatureScheme) string {
+		t.Helper()
+		chi := &tls.ClientHelloInfo{
+			ServerName:        "example",
+			SupportedVersions: []uint16{tls.VersionTLS13},
+			SignatureSchemes:  []tls.SignatureScheme{scheme},
+		}
+		cert, err := r.GetCertificate(chi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = r.Supports(chi); err != nil {
+			t.Error(err)
+		}
+		return cert.Leaf.Subject.CommonName
+	}
+	if cn := get(tls.ECDSAWithP256AndSHA256); cn != "example" {
+		t.Errorf("got %q for ECDSA client, want primary pair", cn)
+	}
+	if cn := get(tls.PSSWithSHA256); cn != "rsa" {
+		t.Errorf("got %q for RSA client, want additional pair", cn)
+	}
+	if cn := r.Get().Leaf.Subject.CommonName; cn != "example" {
+		t.Errorf("Get returned %q, want primary pair", cn)
+	}
+
+	// The additional pair is reloaded on its own.
+	writeTestRSAPair(t, dir, "rotated")
+	if res, err := r.pairs[0].Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+	if cn := get(tls.PSSWithSHA256); cn != "rotated" {
+		t.Errorf("got %q after reloading additional pair", cn)
+	}
+
+	r.Stop()
+	if !r.pairs[0].Stopped() {
+		t.Error("additional pair not stopped along with primary one")
+	}
+
+	if _, err = New(certPath, keyPath, time.Hour, WithAdditionalPair(rsaCertPath, filepath.Join(dir, "missing.pem"))); err == nil {
+		t.Error("got no error for unreadable additional pair")
+	}
+}
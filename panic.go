@@ -0,0 +1,36 @@
+package certreloader
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// errPanic is wrapped by the error of a reload which panicked, e.g. in a hook
+// such as WithPreParseHook or WithVeto.
+var errPanic = errors.New("reload panicked")
+
+// panicked logs a recovered panic p with the stack trace of the panicking
+// goroutine, and converts it into an error. It must be called from the
+// deferred function which recovered p.
+func panicked(p interface{}) error {
+	log.Printf("recovered panic: %v\n%s", p, debug.Stack())
+	return fmt.Errorf("%w: %v", errPanic, p)
+}
+
+// recoverTick keeps background reloading alive after a panic in tick or
+// fetchStaple, e.g. in a callback, reporting it like a failed reload.
+func (r *Reloader) recoverTick() {
+	p := recover()
+	if p == nil {
+		return
+	}
+	err := panicked(p)
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("recovered panic in error callback: %v", p)
+		}
+	}()
+	r.reportError(reasonPanicked, err)
+}
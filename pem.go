@@ -0,0 +1,173 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	errSwappedPaths     = errors.New("certificate file contains a private key and private key file contains a certificate; are the paths swapped?")
+	errInvalidBase64Key = errors.New("invalid base64 encoded private key")
+
+	errUTF16       = errors.New("file is UTF-16 encoded, while PEM must be ASCII; save it as UTF-8 without BOM")
+	errCRLineEnds  = errors.New("file has CR line endings without LF, which PEM does not allow; convert them to LF")
+	errCRCRLFEnds  = errors.New("file has CR CR LF line endings, likely from converting CRLF twice; convert them to LF")
+	utf8BOM        = []byte("\xef\xbb\xbf")
+	utf16BOMs      = [][]byte{{0xff, 0xfe}, {0xfe, 0xff}}
+	pemBeginMarker = []byte("-----BEGIN ")
+)
+
+// pemTypes reports whether data contains any certificate or private key block.
+func pemTypes(data []byte) (hasCert, hasKey bool) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			hasCert = true
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			hasKey = true
+		}
+	}
+}
+
+// explainPairError replaces err of tls.X509KeyPair with a helpful one for
+// recognized mistakes.
+func explainPairError(certPEM, keyPEM []byte, err error) error {
+	certHasCert, certHasKey := pemTypes(certPEM)
+	keyHasCert, keyHasKey := pemTypes(keyPEM)
+	if certHasKey && !certHasCert && keyHasCert && !keyHasKey {
+		return errSwappedPaths
+	}
+	if mismatch := checkPEMKeyMatch(certPEM, keyPEM); mismatch != nil {
+		return mismatch
+	}
+	return err
+}
+
+// checkPEMKeyMatch parses the first certificate of certPEM and the first
+// private key of keyPEM, and returns the error of checkKeyMatch for them, or
+// nil if either cannot be parsed.
+func checkPEMKeyMatch(certPEM, keyPEM []byte) error {
+	var leaf *x509.Certificate
+	var key crypto.PrivateKey
+	for block, rest := pem.Decode(certPEM); block != nil && leaf == nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			leaf, _ = x509.ParseCertificate(block.Bytes)
+		}
+	}
+	for block, rest := pem.Decode(keyPEM); block != nil && key == nil; block, rest = pem.Decode(rest) {
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			key = parsePrivateKey(block.Bytes)
+			zero(block.Bytes)
+		}
+	}
+	if leaf == nil || key == nil {
+		return nil
+	}
+	return checkKeyMatch(&tls.Certificate{PrivateKey: key, Leaf: leaf})
+}
+
+// parsePrivateKey parses der in any of the encodings accepted by
+// tls.X509KeyPair, or returns nil.
+func parsePrivateKey(der []byte) crypto.PrivateKey {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key
+	}
+	return nil
+}
+
+// checkComplete fails with ErrIncompleteFile unless data read from src has a
+// PEM block, or with a precise error if data could not be decoded due to its
+// encoding or line endings, e.g. after editing on another platform.
+func checkComplete(src source, data []byte) error {
+	if block, _ := pem.Decode(data); block == nil {
+		if err := checkEncoding(data); err != nil {
+			return fmt.Errorf("%s: %w", src.name(), err)
+		}
+		return fmt.Errorf("%s: %w", src.name(), ErrIncompleteFile)
+	}
+	return nil
+}
+
+// checkEncoding explains why data, which has no PEM block, could not be
+// decoded, or returns nil if it looks like plain ASCII anyway.
+func checkEncoding(data []byte) error {
+	for _, bom := range utf16BOMs {
+		if bytes.HasPrefix(data, bom) {
+			return errUTF16
+		}
+	}
+	if !bytes.Contains(data, pemBeginMarker) {
+		return nil
+	}
+	switch {
+	case bytes.Contains(data, []byte("\r\r\n")):
+		return errCRCRLFEnds
+	case bytes.IndexByte(data, '\r') >= 0 && bytes.IndexByte(data, '\n') < 0:
+		return errCRLineEnds
+	}
+	return nil
+}
+
+// trimBOM strips a leading UTF-8 byte order mark, which some editors write
+// and which hides the first PEM block from pem.Decode. It never carries
+// meaning in PEM, so that stripping it cannot alter a valid file. CRLF line
+// endings need no normalization, since pem.Decode handles them.
+func trimBOM(data []byte) []byte {
+	return bytes.TrimPrefix(data, utf8BOM)
+}
+
+// wrapBase64Key converts data read from src, base64 encoded PKCS #8 DER as
+// expected by WithBase64DERKey, into a PEM PRIVATE KEY block. Whitespace,
+// including line breaks, is ignored. Empty data, or data cut short within the
+// base64 alphabet, fails with ErrIncompleteFile, since it may have been read
+// while being written; any other malformed data fails with
+// errInvalidBase64Key. Its intermediate copies of key material are zeroed,
+// while data is left to the caller.
+func wrapBase64Key(src source, data []byte) ([]byte, error) {
+	data = bytes.Join(bytes.Fields(data), nil)
+	defer zero(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s: %w", src.name(), ErrIncompleteFile)
+	}
+	der := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	defer zero(der)
+	n, err := base64.StdEncoding.Decode(der, data)
+	if err != nil {
+		if len(data)%4 != 0 && isBase64(data) {
+			return nil, fmt.Errorf("%s: %w: base64 cut short", src.name(), ErrIncompleteFile)
+		}
+		return nil, fmt.Errorf("%s: %w: %v", src.name(), errInvalidBase64Key, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der[:n]}), nil
+}
+
+// isBase64 reports whether data consists of the standard base64 alphabet and
+// padding only.
+func isBase64(data []byte) bool {
+	for _, c := range data {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '+', c == '/', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package certreloader
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSwappedPaths(t *testing.T) {
+	certPath, keyPath := writeTestPair(t, t.TempDir(), "example")
+	r, err := New(keyPath, certPath, time.Hour)
+	if !errors.Is(err, errSwappedPaths) || !errors.Is(err, ErrInitialLoad) {
+		t.Errorf("got %v, want %v", err, errSwappedPaths)
+	}
+	if r != nil {
+		r.Stop()
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	certPEM, keyPEM := newTestPair(t, "example")
+	utf16 := func(data []byte) []byte {
+		out := []byte{0xff, 0xfe}
+		for _, b := range data {
+			out = append(out, b, 0)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name    string
+		convert func([]byte) []byte
+		want    error // nil if loading succeeds
+	}{
+		{"BOM", func(data []byte) []byte { return append([]byte("\xef\xbb\xbf"), data...) }, nil},
+		{"CRLF", func(data []byte) []byte { return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n")) }, nil},
+		{"CR", func(data []byte) []byte { return bytes.ReplaceAll(data, []byte("\n"), []byte("\r")) }, errCRLineEnds},
+		{"CRCRLF", func(data []byte) []byte { return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\r\n")) }, errCRCRLFEnds},
+		{"UTF16", utf16, errUTF16},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+			writeTestFile(t, certPath, tc.convert(certPEM))
+			writeTestFile(t, keyPath, tc.convert(keyPEM))
+			r, err := New(certPath, keyPath, time.Hour)
+			if r != nil {
+				defer r.Stop()
+			}
+			if !errors.Is(err, tc.want) || (tc.want != nil && errors.Is(err, ErrIncompleteFile)) {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+
+			// Only the key is affected.
+			writeTestFile(t, certPath, certPEM)
+			writeTestFile(t, keyPath, tc.convert(keyPEM))
+			if r, err = New(certPath, keyPath, time.Hour); r != nil {
+				r.Stop()
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("key: got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestExplainPairError(t *testing.T) {
+	certPEM, keyPEM := newTestPair(t, "example")
+	_, otherKeyPEM := newTestPair(t, "other")
+	// Whatever the wording of crypto/tls, a mismatch is recognized.
+	stdErr := errors.New("tls: reworded error")
+	if err := explainPairError(certPEM, otherKeyPEM, stdErr); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("got %v, want %v", err, ErrKeyMismatch)
+	}
+	if err := explainPairError(certPEM, keyPEM, stdErr); err != stdErr {
+		t.Errorf("got %v for matching pair, want %v", err, stdErr)
+	}
+	if err := explainPairError(certPEM, []byte("garbage"), stdErr); err != stdErr {
+		t.Errorf("got %v for unparsable key, want %v", err, stdErr)
+	}
+}
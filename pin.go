@@ -0,0 +1,90 @@
+package certreloader
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"sync/atomic"
+	"unsafe"
+)
+
+var errInvalidPin = errors.New("pinned certificate has no private key")
+
+// Pin installs cert in place of the loaded certificate, and keeps serving it
+// regardless of the files until Unpin is called. It is an escape hatch for
+// operators during an incident, e.g. to keep a known-good certificate live
+// while the files are broken or disputed, not a means of normal operation.
+// While pinned, reloads still read and check the files, and report changes
+// with Reason "pinned, not installed", but never install them. Pinning again
+// replaces the pinned certificate. cert must not be modified afterwards; its
+// Leaf is parsed if absent. Pin fails in certificate-only mode.
+func (r *Reloader) Pin(cert *tls.Certificate) error {
+	if r.certOnly {
+		return errCertOnly
+	}
+	if cert == nil || cert.PrivateKey == nil || len(cert.Certificate) == 0 {
+		return errInvalidPin
+	}
+	c := *cert
+	if c.Leaf == nil {
+		var err error
+		if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	if err := checkKeyMatch(&c); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	snap := &snapshot{cert: &c, notAfter: c.Leaf.NotAfter.Unix()}
+	if old := r.snapshot(); old != nil {
+		snap.clientCAs = old.clientCAs
+	}
+	snap.config = r.newConfig(snap)
+	r.pinned = true
+	atomic.StorePointer(
+		(*unsafe.Pointer)(unsafe.Pointer(&r.snap)),
+		unsafe.Pointer(snap),
+	)
+	r.lastSwap.Store(r.now())
+	r.broadcastInstalled()
+	r.mu.Unlock()
+	r.notify(ReloadResult{Changed: true, Reason: reasonPinned}, nil)
+	return nil
+}
+
+// Unpin releases the certificate pinned by Pin, and reloads right away,
+// installing the files even if neither they, nor the generation of
+// WithGenerationFile, nor the trigger file of WithTriggerFile changed while
+// pinned, and regardless of WithChangeComparator. The outcome is returned
+// like Reload; if the files cannot be loaded, the pinned certificate keeps
+// being served as if it was the last loaded one, and the next successful
+// reload replaces it. Unpin does nothing unless pinned.
+func (r *Reloader) Unpin() (ReloadResult, error) {
+	r.mu.Lock()
+	if !r.pinned {
+		r.mu.Unlock()
+		return ReloadResult{Reason: reasonUnchanged}, nil
+	}
+	r.pinned = false
+	// Force reading and installing the files, even if identical.
+	r.certDgst, r.keyDgst = 0, 0
+	r.certStamp, r.keyStamp = fileStamp{}, fileStamp{}
+	r.genSeen = false
+	r.forceNext = true
+	zero(r.prevKeyPEM)
+	r.prevCertPEM, r.prevKeyPEM = nil, nil
+	res, err := r.reloadLocked(context.Background(), true)
+	r.mu.Unlock()
+	r.observe(res, err)
+	r.notify(res, err)
+	return res, err
+}
+
+// Pinned reports whether a certificate is pinned by Pin.
+func (r *Reloader) Pinned() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pinned
+}
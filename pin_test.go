@@ -0,0 +1,120 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPin(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	r, err := New(certPath, keyPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	var reloaded int
+	r.SetOnReload(func(*tls.Certificate) { reloaded++ })
+
+	pinnedPEM, pinnedKeyPEM := newTestPair(t, "pinned")
+	pinned, err := tls.X509KeyPair(pinnedPEM, pinnedKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Pin(&pinned); err != nil {
+		t.Fatal(err)
+	}
+	if cn := r.Get().Leaf.Subject.CommonName; cn != "pinned" || !r.Pinned() || reloaded != 1 {
+		t.Fatalf("serving %q after Pin, reloaded %d times", cn, reloaded)
+	}
+	checkConsistent(t, r.Get())
+
+	// Changes are detected but not installed while pinned.
+	writeTestPair(t, dir, "rotated")
+	res, err := r.Reload()
+	if err != nil || res.Changed || res.Reason != reasonPinned || res.candidate.Subject.CommonName != "rotated" {
+		t.Fatalf("got %+v, %v while pinned", res, err)
+	}
+	if cn := r.Get().Leaf.Subject.CommonName; cn != "pinned" {
+		t.Fatalf("serving %q while pinned", cn)
+	}
+
+	// Unpin installs the files even though they were already seen.
+	if res, err = r.Unpin(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v from Unpin", res, err)
+	}
+	if cn := r.Get().Leaf.Subject.CommonName; cn != "rotated" || r.Pinned() {
+		t.Fatalf("serving %q after Unpin", cn)
+	}
+	if res, err = r.Unpin(); err != nil || res.Changed {
+		t.Errorf("got %+v, %v from Unpin without pin", res, err)
+	}
+
+	if err = r.Pin(&tls.Certificate{Certificate: pinned.Certificate}); err != errInvalidPin {
+		t.Errorf("got %v without private key, want %v", err, errInvalidPin)
+	}
+	certOnly, err := NewCertOnly(filepath.Join(dir, "cert.pem"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer certOnly.Stop()
+	if err = certOnly.Pin(&pinned); err != errCertOnly {
+		t.Errorf("got %v in certificate-only mode, want %v", err, errCertOnly)
+	}
+}
+
+func TestUnpinTrigger(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	triggerPath := filepath.Join(dir, "trigger")
+	writeTestFile(t, triggerPath, nil)
+	r, err := New(certPath, keyPath, time.Hour, WithTriggerFile(triggerPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	pinnedPEM, pinnedKeyPEM := newTestPair(t, "pinned")
+	pinned, err := tls.X509KeyPair(pinnedPEM, pinnedKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Pin(&pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	// The trigger file is untouched, yet Unpin installs the files.
+	res, err := r.Unpin()
+	if err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v from Unpin", res, err)
+	}
+	if cn := r.Get().Leaf.Subject.CommonName; cn != "example" {
+		t.Fatalf("serving %q after Unpin", cn)
+	}
+	if res, err = r.Reload(); err != nil || !res.skipped {
+		t.Errorf("got %+v, %v with untouched trigger file after Unpin", res, err)
+	}
+}
+
+func TestUnpinComparator(t *testing.T) {
+	r := newTestReloader(t, WithChangeComparator(func(_, _, _, _ []byte) bool { return false }))
+	defer r.Stop()
+	pinnedPEM, pinnedKeyPEM := newTestPair(t, "pinned")
+	pinned, err := tls.X509KeyPair(pinnedPEM, pinnedKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Pin(&pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	// The comparator finds the files unchanged, yet Unpin installs them.
+	res, err := r.Unpin()
+	if err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v from Unpin", res, err)
+	}
+	if cn := r.Get().Leaf.Subject.CommonName; cn != "example" {
+		t.Errorf("serving %q after Unpin", cn)
+	}
+}
@@ -0,0 +1,182 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errNotPKCS7        = errors.New("not a PKCS #7 signed-data bundle")
+	errInvalidPKCS7    = errors.New("malformed PKCS #7 bundle")
+	errEmptyPKCS7      = errors.New("empty PKCS #7 bundle")
+	errNoPKCS7Leaf     = errors.New("PKCS #7 bundle has no unique leaf certificate")
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// NewFromPKCS7 return a new Reloader for a certificate chain exported as a
+// PKCS #7 bundle (.p7b), in DER or PEM form, and a separate PEM private key,
+// e.g. as exported by some enterprise CAs. The certificates of the bundle may
+// be in any order: the leaf is the only one not issuing any other, followed
+// by its issuers as far as they are included. Changes are detected on the
+// raw bundle. Otherwise it works like New.
+func NewFromPKCS7(p7bPath, keyPath string, interval time.Duration, opts ...Option) (*Reloader, error) {
+	if p7bPath == "" {
+		return nil, errInvalidCertPath
+	}
+	if keyPath == "" {
+		return nil, errInvalidKeyPath
+	}
+	opts = append([]Option{func(r *Reloader) { r.pkcs7 = true }}, opts...)
+	return newReloader(pathSource(p7bPath), pathSource(keyPath), interval, opts)
+}
+
+// pkcs7ToPEM converts a PKCS #7 bundle read from src into PEM certificates,
+// the leaf first. An empty file, or one cut short, fails with
+// ErrIncompleteFile, since it may have been read while being written, while a
+// malformed bundle fails with errInvalidPKCS7.
+func pkcs7ToPEM(src source, data []byte) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	switch {
+	case block != nil && (block.Type == "PKCS7" || block.Type == "CERTIFICATE"):
+		// "CERTIFICATE" is used by some tools for PKCS #7 as well.
+		data = block.Bytes
+	case block == nil && bytes.Contains(data, pemBeginMarker), truncatedDER(data):
+		return nil, fmt.Errorf("%s: %w", src.name(), ErrIncompleteFile)
+	}
+	certs, err := parsePKCS7(data)
+	if err == errEmptyPKCS7 {
+		return nil, fmt.Errorf("%s: %w", src.name(), err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", src.name(), errInvalidPKCS7, err)
+	}
+	chain, err := orderChain(certs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src.name(), err)
+	}
+	var buf bytes.Buffer
+	for _, cert := range chain {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes(), nil
+}
+
+// parsePKCS7 returns the certificates of a DER encoded PKCS #7 signed-data
+// structure (RFC 2315), ignoring everything else.
+func parsePKCS7(der []byte) ([]*x509.Certificate, error) {
+	var info struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue // [0] EXPLICIT
+	}
+	if rest, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, asn1.SyntaxError{Msg: "trailing data"}
+	}
+	if !info.ContentType.Equal(oidPKCS7SignedData) ||
+		info.Content.Class != asn1.ClassContextSpecific || info.Content.Tag != 0 {
+		return nil, errNotPKCS7
+	}
+	var signed struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	}
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &signed); err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for rest := signed.Certificates.Bytes; len(rest) > 0; {
+		var raw asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &raw); err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errEmptyPKCS7
+	}
+	return certs, nil
+}
+
+// truncatedDER reports whether der is shorter than the length in the header of
+// its outermost SEQUENCE, or than the header itself.
+func truncatedDER(der []byte) bool {
+	if len(der) < 2 {
+		return true
+	}
+	if der[0] != 0x30 {
+		return false
+	}
+	n, off := int(der[1]), 2
+	if n&0x80 != 0 {
+		k := n & 0x7f
+		if k == 0 || k > 4 {
+			return false // indefinite or implausible length
+		}
+		if len(der) < off+k {
+			return true
+		}
+		n = 0
+		for _, b := range der[off : off+k] {
+			n = n<<8 | int(b)
+		}
+		off += k
+	}
+	return len(der) < off+n
+}
+
+// orderChain returns the leaf of certs, followed by its issuers among certs.
+// Certificates not part of the chain of the leaf are dropped.
+func orderChain(certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	issues := func(issuer, cert *x509.Certificate) bool {
+		return issuer != cert && bytes.Equal(issuer.RawSubject, cert.RawIssuer) &&
+			cert.CheckSignatureFrom(issuer) == nil
+	}
+	var leaf *x509.Certificate
+	for _, cert := range certs {
+		isIssuer := false
+		for _, other := range certs {
+			if issues(cert, other) {
+				isIssuer = true
+				break
+			}
+		}
+		if isIssuer {
+			continue
+		}
+		if leaf != nil {
+			return nil, errNoPKCS7Leaf
+		}
+		leaf = cert
+	}
+	if leaf == nil {
+		return nil, errNoPKCS7Leaf
+	}
+	chain := []*x509.Certificate{leaf}
+	for len(chain) < len(certs) {
+		var next *x509.Certificate
+		for _, cert := range certs {
+			if issues(cert, chain[len(chain)-1]) {
+				next = cert
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		chain = append(chain, next)
+	}
+	return chain, nil
+}
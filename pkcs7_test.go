@@ -0,0 +1,115 @@
+package certreloader
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// marshalTestPKCS7 returns a certificates-only PKCS #7 bundle of certs, as
+// written by `openssl crl2pkcs7 -nocrl`.
+func marshalTestPKCS7(t *testing.T, certs ...*x509.Certificate) []byte {
+	t.Helper()
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+	emptySet := asn1.RawValue{Tag: asn1.TagSet, IsCompound: true}
+	signed, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      emptySet,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{
+		ContentType: oidPKCS7SignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signed},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestNewFromPKCS7(t *testing.T) {
+	dir := t.TempDir()
+	_, root, rootKey := issueTestCert(t, "root", true, nil, nil)
+	_, inter, interKey := issueTestCert(t, "intermediate", true, root, rootKey)
+	_, leaf, leafKey := issueTestCert(t, "example", false, inter, interKey)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7bPath := filepath.Join(dir, "chain.p7b")
+	keyPath := filepath.Join(dir, "key.pem")
+	writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+
+	// Unordered DER bundle.
+	der := marshalTestPKCS7(t, root, leaf, inter)
+	writeTestFile(t, p7bPath, der)
+	r, err := NewFromPKCS7(p7bPath, keyPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	checkConsistent(t, r.Get())
+	chain := r.Get().Certificate
+	if len(chain) != 3 || !bytes.Equal(chain[0], leaf.Raw) || !bytes.Equal(chain[1], inter.Raw) || !bytes.Equal(chain[2], root.Raw) {
+		t.Errorf("got chain of %d certificates in wrong order", len(chain))
+	}
+
+	// The same bundle in PEM form is a change of the file.
+	writeTestFile(t, p7bPath, pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der}))
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Errorf("got %+v, %v for PEM bundle", res, err)
+	}
+	if res, err := r.Reload(); err != nil || res.Changed {
+		t.Errorf("got %+v, %v without changes", res, err)
+	}
+
+	pemBundle := pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der})
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		want   error
+		reason string
+	}{
+		{"empty file", nil, ErrIncompleteFile, reasonIncomplete},
+		{"truncated", der[:len(der)/2], ErrIncompleteFile, reasonIncomplete},
+		{"truncated PEM", pemBundle[:len(pemBundle)/2], ErrIncompleteFile, reasonIncomplete},
+		{"malformed", []byte{0x30, 0x03, 0x01, 0x01, 0xff}, errInvalidPKCS7, reasonRejected},
+		{"not PKCS #7", leaf.Raw, errInvalidPKCS7, reasonRejected},
+		{"empty bundle", marshalTestPKCS7(t), errEmptyPKCS7, reasonRejected},
+		{"two leaves", marshalTestPKCS7(t, leaf, root), errNoPKCS7Leaf, reasonRejected},
+	} {
+		writeTestFile(t, p7bPath, tc.data)
+		res, err := r.Reload()
+		if !errors.Is(err, tc.want) || res.Reason != tc.reason || res.Changed {
+			t.Errorf("%s: got %+v, %v, want %q, %v", tc.name, res, err, tc.reason, tc.want)
+		}
+		if tc.want != ErrIncompleteFile && errors.Is(err, ErrIncompleteFile) {
+			t.Errorf("%s: got %v, retried as incomplete", tc.name, err)
+		}
+	}
+	if !bytes.Equal(r.Get().Certificate[0], leaf.Raw) {
+		t.Error("failed reload replaced certificate")
+	}
+}
@@ -0,0 +1,104 @@
+package certreloader
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// KeyPolicy restricts the public key of certificates to be loaded. The zero
+// value accepts any RSA, ECDSA or Ed25519 key.
+type KeyPolicy struct {
+	// MinRSABits is the minimum RSA modulus size in bits. Zero means no limit.
+	MinRSABits int
+	// ECDSACurves lists acceptable curves for ECDSA keys. Empty means any.
+	ECDSACurves []elliptic.Curve
+	// DenyEd25519 rejects Ed25519 keys.
+	DenyEd25519 bool
+}
+
+func (p *KeyPolicy) check(pub crypto.PublicKey) error {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if bits := pub.N.BitLen(); bits < p.MinRSABits {
+			return fmt.Errorf("RSA key size %d is less than %d bits", bits, p.MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if len(p.ECDSACurves) == 0 {
+			return nil
+		}
+		for _, curve := range p.ECDSACurves {
+			if pub.Curve == curve {
+				return nil
+			}
+		}
+		return fmt.Errorf("ECDSA curve %s is not allowed", pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		if p.DenyEd25519 {
+			return fmt.Errorf("Ed25519 key is not allowed")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
+
+// ParsePolicy rejects leaf certificates with properties deemed unacceptable,
+// regardless of what the crypto/x509 of the running Go version (and its
+// GODEBUG settings) tolerates, so that the same certificates are served
+// everywhere. The zero value accepts anything that parses.
+type ParsePolicy struct {
+	// RequireSAN rejects certificates without any subject alternative name,
+	// i.e. relying on the common name only.
+	RequireSAN bool
+	// RequireServerAuth rejects certificates whose extended key usage
+	// excludes server authentication. A certificate without extended key
+	// usage is accepted.
+	RequireServerAuth bool
+	// RejectNegativeSerial rejects negative serial numbers, which some Go
+	// versions accept only with GODEBUG=x509negativeserial=1.
+	RejectNegativeSerial bool
+	// RejectSHA1 rejects certificates signed using SHA-1.
+	RejectSHA1 bool
+	// MaxValidity rejects certificates valid for longer. Zero means no limit.
+	MaxValidity time.Duration
+}
+
+func (p *ParsePolicy) check(c *x509.Certificate) error {
+	if p.RequireSAN && len(c.DNSNames) == 0 && len(c.IPAddresses) == 0 &&
+		len(c.EmailAddresses) == 0 && len(c.URIs) == 0 {
+		return fmt.Errorf("certificate %q has no subject alternative name", c.Subject)
+	}
+	if p.RequireServerAuth && len(c.ExtKeyUsage) > 0 && !hasServerAuth(c) {
+		return fmt.Errorf("certificate %q is not valid for server authentication", c.Subject)
+	}
+	if p.RejectNegativeSerial && c.SerialNumber.Sign() < 0 {
+		return fmt.Errorf("certificate %q has negative serial number", c.Subject)
+	}
+	if p.RejectSHA1 {
+		switch c.SignatureAlgorithm {
+		case x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1:
+			return fmt.Errorf("certificate %q is signed using %s", c.Subject, c.SignatureAlgorithm)
+		}
+	}
+	if p.MaxValidity > 0 {
+		if d := c.NotAfter.Sub(c.NotBefore); d > p.MaxValidity {
+			return fmt.Errorf("certificate %q is valid for %s, more than %s", c.Subject, d, p.MaxValidity)
+		}
+	}
+	return nil
+}
+
+func hasServerAuth(c *x509.Certificate) bool {
+	for _, u := range c.ExtKeyUsage {
+		if u == x509.ExtKeyUsageServerAuth || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,438 @@
+package certreloader
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"hash/fnv"
+	"math/big"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyPolicy(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strict := KeyPolicy{
+		MinRSABits:  2048,
+		ECDSACurves: []elliptic.Curve{elliptic.P256()},
+		DenyEd25519: true,
+	}
+	for _, tc := range []struct {
+		name   string
+		policy KeyPolicy
+		pub    interface{}
+		want   string
+	}{
+		{"rsa/any", KeyPolicy{}, &rsaKey.PublicKey, ""},
+		{"rsa/strict", strict, &rsaKey.PublicKey, "RSA key size 1024 is less than 2048 bits"},
+		{"ecdsa/any", KeyPolicy{}, &ecKey.PublicKey, ""},
+		{"ecdsa/strict", strict, &ecKey.PublicKey, "ECDSA curve P-384 is not allowed"},
+		{"ed25519/any", KeyPolicy{}, edPub, ""},
+		{"ed25519/strict", strict, edPub, "Ed25519 key is not allowed"},
+	} {
+		err := tc.policy.check(tc.pub)
+		if got := errString(err); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWithKeyPolicy(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	policy := WithKeyPolicy(KeyPolicy{ECDSACurves: []elliptic.Curve{elliptic.P256()}})
+	var errs []error
+	r, err := New(certPath, keyPath, time.Hour, policy, WithOnError(func(err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	old := r.Get()
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePolicyPair(t, certPath, keyPath, key, time.Hour)
+	r.tick()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "ECDSA curve P-384 is not allowed") {
+		t.Errorf("got errors %v, want rejection by curve", errs)
+	}
+	if r.Get() != old {
+		t.Error("certificate replaced despite key policy")
+	}
+	if _, err := New(certPath, keyPath, time.Hour, policy); !errors.Is(err, ErrInitialLoad) {
+		t.Errorf("got %v, want %v", err, ErrInitialLoad)
+	}
+}
+
+// writePolicyPair writes a self-signed certificate for key, valid for
+// validity, along with key to certPath / keyPath.
+func writePolicyPair(t *testing.T, certPath, keyPath string, key crypto.Signer, validity time.Duration) {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "example"},
+		DNSNames:     []string{"example"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(validity - time.Minute),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestVeto(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "a.example")
+	var errs []error
+	r, err := New(certPath, keyPath, time.Hour, WithOnError(func(err error) { errs = append(errs, err) }),
+		WithVeto(func(old, new *x509.Certificate) error {
+			if old.Subject.CommonName != new.Subject.CommonName {
+				return errors.New("subject changed")
+			}
+			return nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	writeTestPair(t, dir, "b.example")
+	r.tick()
+	if cn := r.Leaf().Subject.CommonName; cn != "a.example" || len(errs) != 1 {
+		t.Errorf("got certificate for %q, errors %v after vetoed rotation", cn, errs)
+	}
+	writeTestPair(t, dir, "a.example")
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Errorf("got %+v, %v for allowed rotation", res, err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	now := time.Now()
+	good := &x509.Certificate{
+		Subject:            pkix.Name{CommonName: "example"},
+		DNSNames:           []string{"example"},
+		SerialNumber:       big.NewInt(1),
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+		NotBefore:          now,
+		NotAfter:           now.Add(24 * time.Hour),
+	}
+	strict := ParsePolicy{
+		RequireSAN:           true,
+		RequireServerAuth:    true,
+		RejectNegativeSerial: true,
+		RejectSHA1:           true,
+		MaxValidity:          90 * 24 * time.Hour,
+	}
+	modify := func(fn func(c *x509.Certificate)) *x509.Certificate {
+		c := *good
+		fn(&c)
+		return &c
+	}
+	for _, tc := range []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{"good", good, ""},
+		{"cn-only", modify(func(c *x509.Certificate) { c.DNSNames = nil }), `certificate "CN=example" has no subject alternative name`},
+		{"client-auth", modify(func(c *x509.Certificate) { c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth} }), `certificate "CN=example" is not valid for server authentication`},
+		{"negative-serial", modify(func(c *x509.Certificate) { c.SerialNumber = big.NewInt(-1) }), `certificate "CN=example" has negative serial number`},
+		{"sha1", modify(func(c *x509.Certificate) { c.SignatureAlgorithm = x509.SHA1WithRSA }), `certificate "CN=example" is signed using SHA1-RSA`},
+		{"validity", modify(func(c *x509.Certificate) { c.NotAfter = now.Add(100 * 24 * time.Hour) }), `certificate "CN=example" is valid for 2400h0m0s, more than 2160h0m0s`},
+	} {
+		if got := errString(strict.check(tc.cert)); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+		if err := (&ParsePolicy{}).check(tc.cert); err != nil {
+			t.Errorf("%s: zero policy rejects: %v", tc.name, err)
+		}
+	}
+}
+
+func TestWithParsePolicy(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	policy := WithParsePolicy(ParsePolicy{RequireSAN: true, MaxValidity: 24 * time.Hour})
+	r, err := New(certPath, keyPath, time.Hour, policy, WithOnError(func(error) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	old := r.Get()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePolicyPair(t, certPath, keyPath, key, 48*time.Hour)
+	res, err := r.Reload()
+	if err == nil || !strings.Contains(err.Error(), "more than 24h0m0s") || res.Reason != reasonRejected {
+		t.Errorf("got %+v, %v, want rejection by validity", res, err)
+	}
+	if r.Get() != old {
+		t.Error("certificate replaced despite parse policy")
+	}
+
+	writePolicyPair(t, certPath, keyPath, key, time.Hour)
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Errorf("got %+v, %v for conforming certificate", res, err)
+	}
+	if _, err := New(certPath, keyPath, time.Hour, WithParsePolicy(ParsePolicy{MaxValidity: time.Minute})); !errors.Is(err, ErrInitialLoad) {
+		t.Errorf("got %v, want %v", err, ErrInitialLoad)
+	}
+}
+
+func TestPinnedFingerprints(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	r, err := New(certPath, keyPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := strings.ToUpper(fingerprint(r.Leaf()))
+	r.Stop()
+
+	r, err = New(certPath, keyPath, time.Hour, WithPinnedFingerprints(fp[:2]+":"+fp[2:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	writeTestPair(t, dir, "example")
+	if _, err := r.Reload(); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("got %v, want %v", err, ErrFingerprintMismatch)
+	}
+	if got := strings.ToUpper(fingerprint(r.Leaf())); got != fp {
+		t.Errorf("serving %s, want pinned %s", got, fp)
+	}
+}
+
+func TestAllowedIssuers(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	type ca struct {
+		pem  []byte
+		cert *x509.Certificate
+		key  crypto.Signer
+	}
+	var a, b ca
+	a.pem, a.cert, a.key = issueTestCert(t, "ca-a", true, nil, nil)
+	b.pem, b.cert, b.key = issueTestCert(t, "ca-b", true, nil, nil)
+	writeLeaf := func(issuer ca) {
+		leafPEM, _, leafKey := issueTestCert(t, "example", false, issuer.cert, issuer.key)
+		keyDER, err := x509.MarshalPKCS8PrivateKey(leafKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, certPath, append(leafPEM, issuer.pem...))
+		writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	}
+	sum := sha256.Sum256(b.cert.RawSubjectPublicKeyInfo)
+	fp := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	for _, tt := range []struct {
+		name            string
+		issuers         []string
+		allowed, denied ca
+		deniedDN        string
+	}{
+		{"distinguished name", []string{a.cert.Subject.String()}, a, b, "CN=ca-b"},
+		{"key fingerprint", []string{"CN=other", fp[:2] + ":" + fp[2:]}, b, a, "CN=ca-a"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			writeLeaf(tt.denied)
+			_, err := New(certPath, keyPath, time.Hour, WithAllowedIssuers(tt.issuers...))
+			if !errors.Is(err, errIssuer) || !strings.Contains(err.Error(), strconv.Quote(tt.deniedDN)) {
+				t.Errorf("got %v, want %v naming %s", err, errIssuer, tt.deniedDN)
+			}
+
+			writeLeaf(tt.allowed)
+			r, err := New(certPath, keyPath, time.Hour, WithOnError(func(error) {}), WithAllowedIssuers(tt.issuers...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			old := r.Get()
+			writeLeaf(tt.denied)
+			if _, err := r.Reload(); !errors.Is(err, errIssuer) {
+				t.Errorf("got %v, want %v", err, errIssuer)
+			}
+			if r.Get() != old {
+				t.Error("certificate from unexpected issuer installed")
+			}
+		})
+	}
+}
+
+func TestSCTCheck(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	writePair := func(sct bool) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: "example"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		if sct {
+			// The SCT list is not parsed, any content will do.
+			tmpl.ExtraExtensions = []pkix.Extension{{Id: oidSCTList, Value: []byte{0x04, 0x00}}}
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+		writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	}
+
+	for _, tt := range []struct {
+		name      string
+		policy    Enforcement
+		sct       bool
+		installed bool
+		err       error
+		warning   error
+	}{
+		{"none", EnforceNone, false, true, nil, nil},
+		{"warn", EnforceWarn, false, true, nil, errNoSCT},
+		{"reject", EnforceReject, false, false, errNoSCT, nil},
+		{"reject/embedded", EnforceReject, true, true, nil, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			writePair(true)
+			var warnings []error
+			r, err := New(certPath, keyPath, time.Hour,
+				WithSCTCheck(tt.policy),
+				WithOnError(func(error) {}),
+				WithOnWarning(func(err error) { warnings = append(warnings, err) }),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			if len(warnings) != 0 {
+				t.Fatalf("initial load warned: %v", warnings)
+			}
+			old := r.Get()
+			writePair(tt.sct)
+			if _, err := r.Reload(); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+			if installed := r.Get() != old; installed != tt.installed {
+				t.Errorf("installed %v, want %v", installed, tt.installed)
+			}
+			switch {
+			case tt.warning == nil && len(warnings) != 0:
+				t.Errorf("unexpected warnings %v", warnings)
+			case tt.warning != nil && (len(warnings) != 1 || !errors.Is(warnings[0], tt.warning)):
+				t.Errorf("got warnings %v, want %v", warnings, tt.warning)
+			}
+		})
+	}
+}
+
+func TestSwapWindow(t *testing.T) {
+	now := time.Now()
+	r := newTestReloader(t, WithSwapWindow(10*time.Minute), WithClock(func() time.Time { return now }))
+	defer r.Stop()
+	old := r.Get()
+	writeTestPair(t, filepath.Dir(r.CertPath()), "example")
+	for _, tt := range []struct {
+		now    time.Time
+		reason string
+	}{
+		{now, reasonDeferred},
+		{old.Leaf.NotAfter.Add(-11 * time.Minute), reasonDeferred},
+		{old.Leaf.NotAfter.Add(-9 * time.Minute), reasonInstalled},
+	} {
+		now = tt.now
+		res, err := r.Reload()
+		if err != nil || res.Reason != tt.reason {
+			t.Fatalf("%v before expiry: got %q, %v, want %q", old.Leaf.NotAfter.Sub(now), res.Reason, err, tt.reason)
+		}
+		if installed := r.Get() != old; installed != res.Changed {
+			t.Errorf("%v before expiry: installed %v, want %v", old.Leaf.NotAfter.Sub(now), installed, res.Changed)
+		}
+	}
+}
+
+func TestHashes(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	var hashed int
+	var infos []ReloadInfo
+	r, err := New(certPath, keyPath, time.Hour,
+		WithChangeHash(func() hash.Hash64 {
+			hashed++
+			return fnv.New64a()
+		}),
+		WithFingerprintHash(crypto.SHA512),
+		WithObserver(func(info ReloadInfo) { infos = append(infos, info) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	sum := sha512.Sum512(r.Leaf().Raw)
+	fp := hex.EncodeToString(sum[:])
+	if len(infos) != 1 || infos[0].NewFingerprint != fp {
+		t.Errorf("got %+v, want SHA-512 fingerprint %s", infos, fp)
+	}
+	if hashed == 0 {
+		t.Error("change hash not used")
+	}
+
+	writeTestPair(t, dir, "example")
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Errorf("got %+v, %v, want change detected", res, err)
+	}
+
+	if _, err := New(certPath, keyPath, time.Hour, WithFingerprintHash(crypto.MD4)); err != errInvalidHash {
+		t.Errorf("got %v, want %v", err, errInvalidHash)
+	}
+}
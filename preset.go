@@ -0,0 +1,61 @@
+package certreloader
+
+import "crypto/tls"
+
+// Preset is a named set of TLS parameters applied by TLSConfig, following
+// https://wiki.mozilla.org/Security/Server_Side_TLS.
+type Preset int
+
+const (
+	// PresetNone leaves every parameter to crypto/tls defaults.
+	PresetNone Preset = iota
+	// PresetModern accepts TLS 1.3 only.
+	PresetModern
+	// PresetIntermediate accepts TLS 1.2 with forward secret AEAD cipher
+	// suites, and TLS 1.3.
+	PresetIntermediate
+)
+
+// presetCurves keeps the post-quantum hybrid preferred by crypto/tls defaults.
+var presetCurves = []tls.CurveID{tls.X25519MLKEM768, tls.X25519, tls.CurveP256, tls.CurveP384}
+
+// config returns a new tls.Config with parameters of p.
+func (p Preset) config() *tls.Config {
+	switch p {
+	case PresetModern:
+		return &tls.Config{
+			MinVersion:       tls.VersionTLS13,
+			CurvePreferences: presetCurves,
+		}
+	case PresetIntermediate:
+		return &tls.Config{
+			MinVersion:       tls.VersionTLS12,
+			CurvePreferences: presetCurves,
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			},
+		}
+	default:
+		return &tls.Config{}
+	}
+}
+
+// TLSConfig returns a new tls.Config serving loaded certificate, with
+// parameters of the preset given to WithTLSPreset. The caller may override any
+// field of the returned config. If WithClientCAFile is given, configs returned
+// by GetConfigForClient are served instead, which derive from the preset
+// unless WithBaseConfig is given. For full control, leave the preset alone or
+// use GetCertificate directly.
+func (r *Reloader) TLSConfig() *tls.Config {
+	config := r.preset.config()
+	config.GetCertificate = r.GetCertificate
+	if r.caSrc != nil {
+		config.GetConfigForClient = r.GetConfigForClient
+	}
+	return config
+}
@@ -0,0 +1,32 @@
+//go:build go1.25
+
+package certreloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+)
+
+// TestPresetCurves needs ConnectionState.CurveID, added in Go 1.25.
+func TestPresetCurves(t *testing.T) {
+	for _, preset := range []Preset{PresetNone, PresetModern, PresetIntermediate} {
+		r := newTestReloader(t, WithTLSPreset(preset))
+		roots := x509.NewCertPool()
+		roots.AddCert(r.Leaf())
+		serverConn, clientConn := net.Pipe()
+		server := tls.Server(serverConn, r.TLSConfig())
+		go server.Handshake()
+		client := tls.Client(clientConn, &tls.Config{RootCAs: roots, ServerName: "example"})
+		if err := client.Handshake(); err != nil {
+			t.Fatalf("preset %d: %v", preset, err)
+		}
+		if curve := client.ConnectionState().CurveID; curve != tls.X25519MLKEM768 {
+			t.Errorf("preset %d negotiated %v, want %v", preset, curve, tls.X25519MLKEM768)
+		}
+		clientConn.Close()
+		serverConn.Close()
+		r.Stop()
+	}
+}
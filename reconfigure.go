@@ -0,0 +1,114 @@
+package certreloader
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	errReconfigureUnsupported = errors.New("reconfigure requires a Reloader created by New")
+	errReconfigureDryRun      = errors.New("cannot reconfigure in dry run mode")
+	errReconfigurePinned      = errors.New("cannot reconfigure while pinned")
+)
+
+// Reconfigure switches to certificate / private key at certPath / keyPath,
+// and reloads from them right away, returning the outcome like Reload. The new
+// files are installed regardless of WithChangeComparator and WithSwapWindow. On
+// failure, both the previous paths and the loaded certificate are kept, as if
+// Reconfigure was never called. Otherwise the new paths are used by all later
+// reloads, and file watching moves to their directories; if they cannot be
+// watched, the error is reported like a failed reload, and the previous ones
+// stay watched. Concurrent reloads see either both previous or both new paths.
+// Paths are resolved like New does. Only a Reloader created by New with a
+// single key that is not fixed by WithFixedKey, and neither a trigger nor a
+// generation file, can be reconfigured. It fails in dry run mode and while a
+// certificate is pinned, since the new files could not be installed.
+func (r *Reloader) Reconfigure(certPath, keyPath string) (ReloadResult, error) {
+	if certPath == "" {
+		return ReloadResult{}, errInvalidCertPath
+	}
+	if keyPath == "" {
+		return ReloadResult{}, errInvalidKeyPath
+	}
+	r.pathMu.RLock()
+	_, certIsPath := r.certSrc.(pathSource)
+	_, keyIsPath := r.keySrc.(pathSource)
+	r.pathMu.RUnlock()
+	if !certIsPath || !keyIsPath || len(r.keyAlts) > 0 || r.triggerSrc != nil || r.genSrc != nil || r.keyOnce {
+		return ReloadResult{}, errReconfigureUnsupported
+	}
+	if r.dryRun {
+		return ReloadResult{}, errReconfigureDryRun
+	}
+	certSrc, keySrc := source(pathSource(certPath)), source(pathSource(keyPath))
+	if !r.relativePaths {
+		var err error
+		if certSrc, err = pathSource(certPath).abs(); err != nil {
+			return ReloadResult{}, err
+		}
+		if keySrc, err = pathSource(keyPath).abs(); err != nil {
+			return ReloadResult{}, err
+		}
+	}
+	res, err := r.reconfigure(certSrc, keySrc)
+	r.observe(res, err)
+	r.notify(res, err)
+	if err == nil {
+		if err := r.rewatch(); err != nil {
+			r.reportError(reasonWatchFailed, err)
+		}
+	}
+	return res, err
+}
+
+// rewatch replaces the watch of startWatch, if any, by one of current paths.
+func (r *Reloader) rewatch() error {
+	r.startMu.Lock()
+	defer r.startMu.Unlock()
+	if r.unwatch == nil || r.Stopped() {
+		return nil
+	}
+	unwatch := r.unwatch
+	if err := r.startWatch(); err != nil {
+		return err
+	}
+	close(unwatch)
+	return nil
+}
+
+func (r *Reloader) reconfigure(certSrc, keySrc source) (res ReloadResult, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pinned {
+		return ReloadResult{}, errReconfigurePinned
+	}
+	oldCertSrc, oldKeySrc := r.certSrc, r.keySrc
+	oldCertDgst, oldKeyDgst := r.certDgst, r.keyDgst
+	oldCertStamp, oldKeyStamp := r.certStamp, r.keyStamp
+	oldCertPEM, oldKeyPEM := r.prevCertPEM, r.prevKeyPEM
+	r.setSources(certSrc, keySrc)
+	// Force reading and installing the new files, even if identical, or not
+	// due yet by the swap window.
+	r.certDgst, r.keyDgst = 0, 0
+	r.certStamp, r.keyStamp = fileStamp{}, fileStamp{}
+	r.prevCertPEM, r.prevKeyPEM = nil, nil
+	r.forceSwap = true
+	res, err = r.reloadLocked(context.Background(), true)
+	r.forceSwap = false
+	if err != nil {
+		r.setSources(oldCertSrc, oldKeySrc)
+		r.certDgst, r.keyDgst = oldCertDgst, oldKeyDgst
+		r.certStamp, r.keyStamp = oldCertStamp, oldKeyStamp
+		r.prevCertPEM, r.prevKeyPEM = oldCertPEM, oldKeyPEM
+		return
+	}
+	zero(oldKeyPEM)
+	return
+}
+
+// setSources replaces certificate / private key sources with r.mu held.
+func (r *Reloader) setSources(certSrc, keySrc source) {
+	r.pathMu.Lock()
+	defer r.pathMu.Unlock()
+	r.certSrc, r.keySrc = certSrc, keySrc
+}
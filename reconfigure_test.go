@@ -0,0 +1,128 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconfigure(t *testing.T) {
+	r := newTestReloader(t, WithOnError(func(error) {}))
+	defer r.Stop()
+	oldCertPath, oldKeyPath := r.CertPath(), r.KeyPath()
+	old := r.Get()
+
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	if _, err := r.Reconfigure(certPath, filepath.Join(dir, "missing.pem")); !os.IsNotExist(err) {
+		t.Fatalf("got %v, want not exist", err)
+	}
+	if r.CertPath() != oldCertPath || r.KeyPath() != oldKeyPath || r.Get() != old {
+		t.Fatal("failed Reconfigure took effect")
+	}
+
+	// Background reloads run concurrently with Reconfigure.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			r.tick()
+		}
+	}()
+	res, err := r.Reconfigure(certPath, keyPath)
+	wg.Wait()
+	if err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v", res, err)
+	}
+	if r.CertPath() != certPath || r.KeyPath() != keyPath || r.Get() == old {
+		t.Errorf("serving %s / %s, want %s / %s", r.CertPath(), r.KeyPath(), certPath, keyPath)
+	}
+	if _, err := r.Reload(); err != nil {
+		t.Error(err)
+	}
+
+	triggered := newTestReloader(t, WithTriggerFile(certPath))
+	defer triggered.Stop()
+	if _, err := triggered.Reconfigure(certPath, keyPath); err != errReconfigureUnsupported {
+		t.Errorf("got %v, want %v", err, errReconfigureUnsupported)
+	}
+}
+
+func TestReconfigureForced(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		pin  bool
+		want error // nil if the new files are installed
+	}{
+		{"comparator", []Option{WithChangeComparator(func(_, _, _, _ []byte) bool { return false })}, false, nil},
+		{"swap window", []Option{WithSwapWindow(time.Minute)}, false, nil},
+		{"dry run", []Option{WithDryRun()}, false, errReconfigureDryRun},
+		{"pinned", nil, true, errReconfigurePinned},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestReloader(t, tc.opts...)
+			defer r.Stop()
+			oldCertPath, oldKeyPath := r.CertPath(), r.KeyPath()
+			if tc.pin {
+				pinned, err := tls.X509KeyPair(newTestPair(t, "pinned"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = r.Pin(&pinned); err != nil {
+					t.Fatal(err)
+				}
+			}
+			old := r.Get()
+
+			certPath, keyPath := writeTestPair(t, t.TempDir(), "reconfigured")
+			res, err := r.Reconfigure(certPath, keyPath)
+			if err != tc.want {
+				t.Fatalf("got %+v, %v, want %v", res, err, tc.want)
+			}
+			if tc.want != nil {
+				if r.CertPath() != oldCertPath || r.KeyPath() != oldKeyPath || r.Get() != old {
+					t.Error("failed Reconfigure took effect")
+				}
+				return
+			}
+			if !res.Changed || r.Leaf().Subject.CommonName != "reconfigured" {
+				t.Errorf("got %+v, serving %q", res, r.Leaf().Subject.CommonName)
+			}
+		})
+	}
+}
+
+func TestReconfigureWatch(t *testing.T) {
+	certPath, keyPath := writeTestPair(t, t.TempDir(), "example")
+	reloaded := make(chan string, 10)
+	r, err := New(certPath, keyPath, time.Hour, WithFileWatch(10*time.Millisecond),
+		WithOnReload(func(c *tls.Certificate) { reloaded <- c.Leaf.Subject.CommonName }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	dir := t.TempDir()
+	certPath, keyPath = writeTestPair(t, dir, "reconfigured")
+	if _, err = r.Reconfigure(certPath, keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if cn := <-reloaded; cn != "reconfigured" {
+		t.Fatalf("got %q from Reconfigure", cn)
+	}
+
+	// Changes in the new directory are noticed without polling.
+	writeTestPair(t, dir, "rotated")
+	select {
+	case cn := <-reloaded:
+		if cn != "rotated" {
+			t.Errorf("got %q, want rotated", cn)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("change of reconfigured files not noticed by watching")
+	}
+}
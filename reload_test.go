@@ -0,0 +1,69 @@
+package certreloader
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReloadReason(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		change  func(t *testing.T, dir, certPath, keyPath string)
+		changed bool
+		reason  string
+		err     error // wrapped by the returned error, if not nil
+	}{
+		{"unchanged", func(*testing.T, string, string, string) {}, false, reasonUnchanged, nil},
+		{"rewritten", func(t *testing.T, dir, certPath, keyPath string) {
+			data, err := os.ReadFile(certPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, certPath, data)
+		}, false, reasonUnchanged, nil},
+		{"installed", func(t *testing.T, dir, _, _ string) {
+			writeTestPair(t, dir, "rotated")
+		}, true, reasonInstalled, nil},
+		{"read failed", func(t *testing.T, _, _, keyPath string) {
+			if err := os.Remove(keyPath); err != nil {
+				t.Fatal(err)
+			}
+		}, false, reasonReadFailed, os.ErrNotExist},
+		{"incomplete", func(t *testing.T, _, certPath, _ string) {
+			writeTestFile(t, certPath, nil)
+		}, false, reasonIncomplete, ErrIncompleteFile},
+		{"rejected", func(t *testing.T, _, certPath, _ string) {
+			certPEM, _ := newTestPair(t, "mismatch")
+			writeTestFile(t, certPath, certPEM)
+		}, false, reasonRejected, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certPath, keyPath := writeTestPair(t, dir, "example")
+			r, err := New(certPath, keyPath, time.Hour, WithOnError(func(error) {}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			old := r.Get()
+
+			tc.change(t, dir, certPath, keyPath)
+			res, err := r.Reload()
+			if res.Changed != tc.changed || res.Reason != tc.reason {
+				t.Errorf("got %+v, want Changed %v and Reason %q", res, tc.changed, tc.reason)
+			}
+			if tc.reason == reasonUnchanged || tc.reason == reasonInstalled {
+				if err != nil {
+					t.Errorf("got %v", err)
+				}
+			} else if err == nil || tc.err != nil && !errors.Is(err, tc.err) {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+			if (r.Get() != old) != tc.changed {
+				t.Errorf("certificate replaced %v, want %v", r.Get() != old, tc.changed)
+			}
+		})
+	}
+}
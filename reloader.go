@@ -2,16 +2,22 @@
 package certreloader
 
 import (
+	"bytes"
+	"context"
+	"crypto"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"hash"
 	"log"
-	"path/filepath"
+	"log/slog"
+	"math/big"
+	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
-
-	"github.com/cespare/xxhash"
 )
 
 // Reloader converts X.509 certificate and private key in PEM format to
@@ -19,66 +25,461 @@ import (
 // tries to reload atomically when changes were detected. Reload failure will
 // be logged and will not break previously loaded one.
 type Reloader struct {
-	certPath string
-	keyPath  string
-	certDgst uint64
-	keyDgst  uint64
-	cert     *tls.Certificate
-	chStop   chan struct{}
+	certSrc   source // replaced by Reconfigure, guarded by mu and pathMu
+	keySrc    source
+	pathMu    sync.RWMutex // guards certSrc and keySrc for readers outside reload
+	certOnly  bool
+	keyAlts   []source // additional candidate keys, see NewWithKeys
+	certDgst  uint64
+	keyDgst   uint64
+	certStamp fileStamp
+	keyStamp  fileStamp
+	snap      *snapshot
+	chStop    chan struct{}
+	ctx       context.Context // canceled by Stop
+	cancel    context.CancelFunc
+	interval  time.Duration
+	startMu   sync.Mutex // guards started and unwatch
+	started   bool
+	unwatch   chan struct{} // stops the watch of startWatch, nil unless watching
+	mu        sync.Mutex    // serializes reload
+	bindMu    sync.Mutex    // guards bound and their Certificates
+	retryMu   sync.Mutex    // guards retry
+	retry     *time.Timer   // pending retry of WithIncompleteRetry, if any
+	bound     []*tls.Config
+	lastErr   error // of the latest reload if it failed, guarded by mu
+	pinned    bool  // see Pin, guarded by mu
+	pairSpecs []pairSpec
+	pairs     []*Reloader   // see WithAdditionalPair
+	sem       chan struct{} // shared by reloaders of a Manager, see WithReloadConcurrency
+
+	stapleFetch func(issuer *x509.Certificate, serial *big.Int) ([]byte, error) // see WithOCSPFetcher
+	stapleEvery time.Duration
+	stapleNow   chan struct{} // signals installation of a new certificate
+
+	overrideMu    sync.Mutex   // serializes writers of the maps below
+	alpnCerts     atomic.Value // map[string]*tls.Certificate by protocol, copied on write
+	challenges    atomic.Value // map[string]*tls.Certificate by domain, copied on write
+	nameOverrides atomic.Value // map[string]nameOverride by server name, copied on write
+
+	stapleSrc    source
+	stapleDgst   uint64
+	issuerSrc    source // see WithOCSPIssuerFile
+	issuerDgst   uint64
+	caSrc        source
+	caDgst       uint64
+	chainSrcs    []source // see WithChainFiles
+	chainDgst    uint64
+	passSrc      source
+	passDgst     uint64
+	baseConfig   *tls.Config
+	triggerSrc   source
+	triggerStamp fileStamp
+	forceNext    bool   // bypasses the trigger gate until the next commit
+	forceSwap    bool   // bypasses the swap window, set by Reconfigure
+	genSrc       source // see WithGenerationFile
+	generation   int64  // of the last successful reload, if genSeen
+	genSeen      bool
+	preset       Preset
+
+	strictExpiry     bool
+	expiryGrace      time.Duration
+	fallback         *tls.Certificate // see WithExpiredFallback
+	swapWindow       time.Duration
+	historySize      int
+	initialDelay     time.Duration
+	history          *history // nil if disabled
+	staleAfter       time.Duration
+	watchSettle      time.Duration
+	watchEvents      WatchEvent
+	changeHash       func() hash.Hash64 // see WithChangeHash
+	fpHash           crypto.Hash        // see WithFingerprintHash, 0 means SHA-256
+	watchMinInterval time.Duration
+	relativePaths    bool
+	keyPolicy        *KeyPolicy
+	parsePolicy      *ParsePolicy
+	pins             map[string]bool // normalized fingerprints, see WithPinnedFingerprints
+	issuers          map[string]bool // DNs or normalized fingerprints, see WithAllowedIssuers
+	parseCache       *ParseCache
+	keyEvery         int // see WithRareKeyChanges
+	keySkips         int // reloads since keys were last read
+	keyOnce          bool
+	fixedKey         crypto.PrivateKey // loaded initially if keyOnce
+	maxFileSize      int64
+	maxChainLen      int
+	incompleteRetry  time.Duration
+	reloadTimeout    time.Duration
+	bundle           bool                         // see NewFromBundle
+	pkcs7            bool                         // see NewFromPKCS7
+	readFile         func(string) ([]byte, error) // replaces reading of paths in tests
+	racyWindow       time.Duration                // see racyStampWindow, shortened in tests
+	sctPolicy        Enforcement
+	checkTrust       bool
+	rotationWarn     time.Duration
+	roots            *x509.CertPool // for checkTrust, nil means system pool
+	preParse         func(certPEM, keyPEM []byte) error
+	veto             func(old, new *x509.Certificate) error
+	debugLog         *slog.Logger
+	startupSummary   bool
+	dryRun           bool
+	manualStart      bool
+	receiver         func()           // run by Start, see NewFromFIFO
+	clock            func() time.Time // see WithClock
+	guard            func() bool
+	base64Key        bool
+
+	compare     func(oldCert, oldKey, newCert, newKey []byte) bool // see WithChangeComparator
+	prevCertPEM []byte                                             // for compare, guarded by mu
+	prevKeyPEM  []byte
+
+	onReload  atomic.Value // func(*tls.Certificate)
+	onError   atomic.Value // func(error)
+	onWarning atomic.Value // func(error)
+	onRecover atomic.Value // func(error)
+	observer  atomic.Value // func(ReloadInfo)
+	lastOK    atomic.Value // time.Time of last successful reload
+	nextTick  atomic.Value // time.Time of next periodic reload
+	lastSwap  atomic.Value // time.Time of installing the current certificate
+	installed atomic.Value // chan struct{} closed on installing a new certificate
+	paused    int32        // accessed atomically
+	stats     stats
+}
+
+// snapshot is everything installed by a reload, swapped as a whole.
+type snapshot struct {
+	cert      *tls.Certificate
+	alts      []*tls.Certificate // further pairs of NewFromBundle
+	notAfter  int64              // of cert.Leaf as Unix time
+	clientCAs *x509.CertPool
+	config    *tls.Config // for GetConfigForClient
+
+	ocspIssuer *x509.Certificate // see WithOCSPIssuerFile
+}
+
+// ReloadResult describes the outcome of a reload attempt.
+type ReloadResult struct {
+	// Changed reports whether a new certificate was installed.
+	Changed bool
+	// Reason is a short description of the outcome, such as "no change",
+	// "installed new cert", "read failed" or "rejected".
+	Reason string
+
+	warnings  []error
+	oldLeaf   *x509.Certificate // loaded before this reload
+	candidate *x509.Certificate // parsed from files, even if not installed
+	recovered error             // last failure before this success
+	skipped   bool              // nothing read since stamps were unchanged
+	detected  bool              // files differ from last successful reload
+	start     time.Time
+	elapsed   time.Duration
 }
 
+const (
+	reasonUnchanged  = "no change"
+	reasonInstalled  = "installed new cert"
+	reasonReadFailed = "read failed"
+	reasonRejected   = "rejected"
+	reasonVetoed     = "vetoed"
+	reasonIncomplete = "incomplete file"
+	reasonDeferred   = "deferred until swap window"
+	reasonPanicked   = "panicked"
+	reasonGeneration = "generation not increased"
+
+	reasonPaused       = "paused"
+	reasonGuarded      = "skipped by guard"
+	reasonWouldInstall = "would install new cert (dry run)"
+	reasonPinned       = "pinned, not installed"
+	reasonWatchFailed  = "watch failed"
+)
+
+// ErrInitialLoad wraps the error of initial load returned by New and other
+// constructors, so that a bad configuration at startup can be told apart
+// from other errors using errors.Is. Subsequent reload failures never replace
+// a loaded certificate.
+var ErrInitialLoad = errors.New("initial load failed")
+
+// ErrIncompleteFile is wrapped by reload errors if a file is empty or contains
+// no PEM data at all, which is usually transient while a non-atomic writer
+// truncates and rewrites it, so that monitoring can ignore it using
+// errors.Is. See also WithIncompleteRetry.
+var ErrIncompleteFile = errors.New("file is empty or has no PEM data, possibly being written")
+
 var (
 	errInvalidCertPath       = errors.New("invalid cert path")
 	errInvalidKeyPath        = errors.New("invalid key path")
+	errInvalidCertFile       = errors.New("invalid cert file")
+	errInvalidKeyFile        = errors.New("invalid key file")
 	errInvalidReloadInterval = errors.New("invalid reload interval")
+	errInvalidGracePeriod    = errors.New("invalid grace period")
+	errInvalidStaleAfter     = errors.New("invalid stale threshold")
+	errInvalidWatchSettle    = errors.New("invalid watch settle period")
+	errCertExpired           = errors.New("certificate expired")
+	errInvalidFallback       = errors.New("invalid fallback certificate")
+	errInvalidHash           = errors.New("fingerprint hash unavailable")
+	errStopped               = errors.New("reloader is stopped")
 )
 
 // New return a new Reloader. The path to certificate / private key will be
-// converted to absolute form internally. If any error happened during the first
-// reload, New will return a nil Reloader and non-nil error.
-func New(certPath, keyPath string, interval time.Duration) (*Reloader, error) {
+// converted to absolute form internally, unless WithRelativePaths is given. If
+// any error happened during the first reload, New will return a nil Reloader
+// and non-nil error wrapping ErrInitialLoad. On platforms providing inode
+// numbers and change times, files whose size, modification time, inode and
+// change time are all unchanged are not read again, unless modified within 2
+// seconds before the reload, since same-size rewrites within one tick of a
+// coarse file system timestamp would go unnoticed otherwise. Elsewhere, files
+// are read on each reload and compared by contents.
+func New(certPath, keyPath string, interval time.Duration, opts ...Option) (*Reloader, error) {
 	if certPath == "" {
 		return nil, errInvalidCertPath
 	}
 	if keyPath == "" {
 		return nil, errInvalidKeyPath
 	}
+	return newReloader(pathSource(certPath), pathSource(keyPath), interval, opts)
+}
+
+// NewFromFiles return a new Reloader reading certificate / private key from
+// already opened files, e.g. descriptors passed from a privileged parent
+// process (wrap a raw descriptor with os.NewFile). The files are re-read from
+// the beginning on each reload, and only when their metadata such as size or
+// modification time changed, or they were modified recently as described for
+// New. Files replaced by rename are not noticed, since the descriptors keep
+// referring to the original ones. The caller retains ownership of the files
+// and must keep them open while the Reloader is in use.
+func NewFromFiles(certFile, keyFile *os.File, interval time.Duration, opts ...Option) (*Reloader, error) {
+	if certFile == nil {
+		return nil, errInvalidCertFile
+	}
+	if keyFile == nil {
+		return nil, errInvalidKeyFile
+	}
+	return newReloader(fileSource{certFile}, fileSource{keyFile}, interval, opts)
+}
+
+func newReloader(certSrc, keySrc source, interval time.Duration, opts []Option) (*Reloader, error) {
 	if interval <= 0 {
 		return nil, errInvalidReloadInterval
 	}
-
-	var err error
-	if certPath, err = filepath.Abs(certPath); err != nil {
-		return nil, err
+	r := &Reloader{
+		certSrc:     certSrc,
+		keySrc:      keySrc,
+		certOnly:    keySrc == nil,
+		staleAfter:  defaultStaleFactor * interval,
+		watchEvents: DefaultWatchEvents,
+		historySize: defaultHistorySize,
+		racyWindow:  racyStampWindow,
 	}
-	if keyPath, err = filepath.Abs(keyPath); err != nil {
-		return nil, err
+	for _, opt := range opts {
+		opt(r)
 	}
-	r := &Reloader{
-		certPath: certPath,
-		keyPath:  keyPath,
+	if !r.relativePaths {
+		for _, src := range r.sources() {
+			p, ok := (*src).(absPather)
+			if !ok {
+				continue
+			}
+			abs, err := p.abs()
+			if err != nil {
+				return nil, err
+			}
+			*src = abs
+		}
 	}
-	if err = r.reload(false); err != nil {
+	if r.expiryGrace < 0 {
+		return nil, errInvalidGracePeriod
+	}
+	if r.staleAfter <= 0 {
+		return nil, errInvalidStaleAfter
+	}
+	if r.watchSettle < 0 {
+		return nil, errInvalidWatchSettle
+	}
+	if r.fpHash != 0 && !r.fpHash.Available() {
+		return nil, errInvalidHash
+	}
+	if r.fallback != nil && r.fallback.Leaf == nil {
+		if len(r.fallback.Certificate) == 0 {
+			return nil, errInvalidFallback
+		}
+		leaf, err := x509.ParseCertificate(r.fallback.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidFallback, err)
+		}
+		fallback := *r.fallback
+		fallback.Leaf = leaf
+		r.fallback = &fallback
+	}
+	if r.historySize > 0 {
+		r.history = &history{buf: make([]ReloadInfo, r.historySize)}
+	}
+	if r.stapleFetch != nil {
+		if r.stapleEvery <= 0 {
+			r.stapleEvery = interval
+		}
+		r.stapleNow = make(chan struct{}, 1)
+	}
+	r.installed.Store(make(chan struct{}))
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	res, err := r.reload(r.ctx, false)
+	r.observe(res, err)
+	if err != nil {
+		r.cancel()
+		return nil, fmt.Errorf("%w: %w", ErrInitialLoad, err)
+	}
+	r.warn(res.warnings...)
+	if r.keyOnce {
+		if r.certOnly || r.bundle {
+			r.cancel()
+			return nil, errFixedKeyUnsupported
+		}
+		r.fixedKey = r.current().PrivateKey
+	}
+	if r.startupSummary {
+		log.Print("loaded certificate: ", summary(r.Leaf()))
+	}
+	if err = r.newPairs(interval); err != nil {
+		r.cancel()
 		return nil, err
 	}
-	ticker := time.NewTicker(interval)
-	chStop := make(chan struct{})
-	go func() {
-		<-chStop
-		ticker.Stop()
-	}()
-	r.chStop = chStop
-	go func(ch <-chan time.Time) {
-		for {
-			<-ch
-			if err := r.reload(true); err != nil {
-				log.Print(err) // TODO: first error only?
-			}
+	r.chStop = make(chan struct{})
+	r.interval = interval
+	if !r.manualStart {
+		if err = r.Start(); err != nil {
+			return nil, err
 		}
-	}(ticker.C)
+	}
 	return r, nil
 }
 
+// Start begins periodic reloading, file watching if WithFileWatch is given,
+// and receiving of frames by NewFromFIFO, for a Reloader created with
+// WithManualStart. New and other constructors start automatically otherwise.
+// Calling Start again has no effect, while it fails once the Reloader is
+// stopped. If file watching cannot be set up, the Reloader is stopped and the
+// error is returned.
+func (r *Reloader) Start() error {
+	r.startMu.Lock()
+	defer r.startMu.Unlock()
+	if r.Stopped() {
+		return errStopped
+	}
+	if r.started {
+		return nil
+	}
+	r.started = true
+	for _, p := range r.pairs {
+		if err := p.Start(); err != nil {
+			r.Stop()
+			return err
+		}
+	}
+	go r.loop(r.interval)
+	if r.stapleFetch != nil {
+		go r.refreshStaples(r.stapleEvery)
+	}
+	if r.watchSettle > 0 {
+		if err := r.startWatch(); err != nil {
+			r.Stop()
+			return err
+		}
+	}
+	if r.receiver != nil {
+		go r.receiver()
+	}
+	return nil
+}
+
+func (r *Reloader) loop(interval time.Duration) {
+	if r.initialDelay > 0 {
+		timer := time.NewTimer(r.initialDelay)
+		r.nextTick.Store(time.Now().Add(r.initialDelay))
+		select {
+		case <-r.chStop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	r.nextTick.Store(time.Now().Add(interval))
+	if r.initialDelay > 0 {
+		r.tick()
+	}
+	for {
+		select {
+		case <-r.chStop:
+			return
+		case t := <-ticker.C:
+			r.nextTick.Store(t.Add(interval))
+			r.tick()
+		}
+	}
+}
+
+// tick performs a background reload.
+func (r *Reloader) tick() {
+	defer r.recoverTick()
+	// Skipped ticks refresh lastOK, so that Healthy does not report
+	// deliberately suspended reloading as stale.
+	if atomic.LoadInt32(&r.paused) != 0 {
+		r.lastOK.Store(r.now())
+		r.logTick(ReloadResult{Reason: reasonPaused}, nil)
+		return
+	}
+	if r.guard != nil && !r.guard() {
+		r.lastOK.Store(r.now())
+		r.logTick(ReloadResult{Reason: reasonGuarded}, nil)
+		return
+	}
+	res, err := r.reload(r.ctx, true)
+	r.observe(res, err)
+	r.logTick(res, err)
+	if r.checkTrust {
+		r.warn(r.checkRoots()...)
+	}
+	if r.rotationWarn > 0 {
+		r.warn(r.checkRotation()...)
+	}
+	if err != nil {
+		r.reportError(res.Reason, err)
+		if r.incompleteRetry > 0 && errors.Is(err, ErrIncompleteFile) {
+			r.scheduleRetry()
+		}
+		return
+	}
+	r.stopRetry()
+	if res.Reason == reasonWouldInstall || res.Reason == reasonPinned {
+		log.Print(res.Reason, ": ", summary(res.candidate))
+	}
+	r.notify(res, nil)
+}
+
+// logTick describes the outcome of a background reload to the debug logger.
+func (r *Reloader) logTick(res ReloadResult, err error) {
+	if r.debugLog == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Bool("changed", res.Changed),
+		slog.String("reason", res.Reason),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	r.debugLog.LogAttrs(context.Background(), slog.LevelDebug, "reload tick", attrs...)
+}
+
+// reportError passes err of background reloading to the error callback, or
+// logs it if there is none.
+func (r *Reloader) reportError(reason string, err error) {
+	if fn := r.loadOnError(); fn != nil {
+		fn(err)
+		return
+	}
+	log.Printf("%s: %v", reason, err) // TODO: first error only?
+}
+
 // Stop further reloading. A stopped reloader cannot be started again. Loaded
 // certificate is still available. Call this method if you don't want resource
 // leak.
@@ -87,49 +488,601 @@ func (r *Reloader) Stop() {
 	case <-r.chStop:
 	default:
 		close(r.chStop)
+		r.cancel()
+		r.stopPairs()
+		r.stopRetry()
 	}
 }
 
-func load(path string) (data []byte, dgst uint64, err error) {
-	data, err = ioutil.ReadFile(path)
-	if err != nil {
+// scheduleRetry arms the single retry timer of WithIncompleteRetry, so that
+// failing retries and ticks do not pile up further retries.
+func (r *Reloader) scheduleRetry() {
+	r.retryMu.Lock()
+	defer r.retryMu.Unlock()
+	if r.Stopped() {
 		return
 	}
-	dgst = xxhash.Sum64(data)
-	return
+	if r.retry == nil {
+		r.retry = time.AfterFunc(r.incompleteRetry, func() {
+			if !r.Stopped() {
+				r.tick()
+			}
+		})
+		return
+	}
+	r.retry.Reset(r.incompleteRetry)
+}
+
+// stopRetry cancels a pending retry of WithIncompleteRetry.
+func (r *Reloader) stopRetry() {
+	r.retryMu.Lock()
+	defer r.retryMu.Unlock()
+	if r.retry != nil {
+		r.retry.Stop()
+	}
+}
+
+// Stopped reports whether Stop has been called.
+func (r *Reloader) Stopped() bool {
+	select {
+	case <-r.chStop:
+		return true
+	default:
+		return false
+	}
+}
+
+// NextReload returns when the next periodic reload is scheduled, or zero time
+// if the Reloader is stopped or not started yet. Reloads triggered by file
+// watching are not scheduled and not reflected. While paused, the scheduled
+// reload is skipped.
+func (r *Reloader) NextReload() time.Time {
+	if r.Stopped() {
+		return time.Time{}
+	}
+	t, _ := r.nextTick.Load().(time.Time)
+	return t
 }
 
-func (r *Reloader) reload(isReload bool) (err error) {
-	certPEM, certDgst, err := load(r.certPath)
+// Pause suspends background reloading, so that staged files are not picked up
+// until Resume is called. Currently loaded certificate keeps being served.
+// Unlike Stop, the background goroutine keeps running, and its skipped ticks
+// count as successful reloads for Healthy. Explicit Reload calls are not
+// affected.
+func (r *Reloader) Pause() {
+	atomic.StoreInt32(&r.paused, 1)
+}
+
+// Resume resumes background reloading suspended by Pause. If reloadNow is true,
+// a background reload is performed immediately instead of at the next tick,
+// unless the Reloader is stopped.
+func (r *Reloader) Resume(reloadNow bool) {
+	atomic.StoreInt32(&r.paused, 0)
+	if reloadNow && !r.Stopped() {
+		r.tick()
+	}
+}
+
+// Reload checks the certificate / private key immediately, and installs them if
+// they were changed. It is safe to call concurrently with background reloading.
+// A non-nil error is returned along with a result whose Reason tells whether
+// the files could not be read or were rejected. Callbacks are invoked as for
+// background reloading. Unlike background reloads, it is not aborted by Stop,
+// and keeps working after it.
+func (r *Reloader) Reload() (ReloadResult, error) {
+	res, err := r.reload(context.Background(), true)
+	r.observe(res, err)
+	r.notify(res, err)
+	return res, err
+}
+
+// reload performs a reload reading files until ctx is done, which is r.ctx for
+// background reloads so that Stop aborts them.
+func (r *Reloader) reload(ctx context.Context, isReload bool) (ReloadResult, error) {
+	if r.sem != nil {
+		r.sem <- struct{}{}
+		defer func() { <-r.sem }()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reloadLocked(ctx, isReload)
+}
+
+// reloadLocked performs a reload with r.mu held.
+func (r *Reloader) reloadLocked(ctx context.Context, isReload bool) (res ReloadResult, err error) {
+	res.start = r.now()
+	began := time.Now() // elapsed time is measured in real time
+	res.oldLeaf = r.Leaf()
+	defer func() {
+		res.elapsed = time.Since(began)
+		r.count(res, err)
+		if err != nil {
+			r.lastErr = err
+		} else {
+			res.recovered, r.lastErr = r.lastErr, nil
+		}
+	}()
+	defer func() {
+		if p := recover(); p != nil {
+			err = panicked(p)
+			res = ReloadResult{Reason: reasonPanicked, oldLeaf: res.oldLeaf, start: res.start}
+		}
+	}()
+
+	if r.reloadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.reloadTimeout)
+		defer cancel()
+	}
+
+	triggerStamp, err := r.statTrigger()
+	if err != nil {
+		res.Reason = reasonReadFailed
+		return
+	}
+	if isReload && r.triggerSrc != nil && !r.forceNext && triggerStamp == r.triggerStamp {
+		r.lastOK.Store(r.now())
+		res.Reason = reasonUnchanged
+		res.skipped = true
+		return
+	}
+
+	var gen int64
+	var genValid bool
+	if r.genSrc != nil {
+		var ok bool
+		if gen, genValid, ok = r.readGeneration(ctx); !ok && isReload {
+			r.lastOK.Store(r.now())
+			res.Reason = reasonGeneration
+			res.skipped = true
+			return
+		}
+	}
+
+	certStamp, certStamped, err := r.stampOf(r.certSrc)
+	if err != nil {
+		res.Reason = reasonReadFailed
+		return
+	}
+	// With WithFixedKey, the key loaded initially is used for good.
+	fixedKey := isReload && r.fixedKey != nil
+	keyStamp, keyStamped := r.keyStamp, true
+	if !fixedKey {
+		if keyStamp, keyStamped, err = r.stampOf(r.keySrc); err != nil {
+			res.Reason = reasonReadFailed
+			return
+		}
+	}
+	if isReload && r.stapleSrc == nil && r.issuerSrc == nil && r.caSrc == nil &&
+		r.passSrc == nil && len(r.keyAlts) == 0 && len(r.chainSrcs) == 0 &&
+		certStamped && keyStamped &&
+		certStamp == r.certStamp && keyStamp == r.keyStamp {
+		r.setGeneration(gen, genValid)
+		r.lastOK.Store(r.now())
+		res.Reason = reasonUnchanged
+		res.skipped = true
+		return
+	}
+
+	certPEM, certDgst, err := r.load(ctx, r.certSrc)
+	if err != nil {
+		res.Reason = reasonReadFailed
+		return
+	}
+	chainPEM, chainDgst, err := r.loadChain(ctx)
+	if err != nil {
+		res.Reason = reasonReadFailed
+		return
+	}
+
+	certPEM = trimBOM(certPEM)
+	if r.pkcs7 {
+		if certPEM, err = pkcs7ToPEM(r.certSrc, certPEM); err != nil {
+			res.Reason = reasonRejected
+			if errors.Is(err, ErrIncompleteFile) {
+				res.Reason = reasonIncomplete
+			}
+			return
+		}
+	} else if err = checkComplete(r.certSrc, certPEM); err != nil {
+		res.Reason = reasonRejected
+		if errors.Is(err, ErrIncompleteFile) {
+			res.Reason = reasonIncomplete
+		}
+		return
+	}
+
+	// With WithRareKeyChanges, keys are assumed unchanged as long as the
+	// certificate is, and read only if anything else changed.
+	skipKeys := isReload && r.keyEvery > 1 && r.compare == nil && certDgst == r.certDgst && r.keySkips+1 < r.keyEvery
+	var keyPEMs [][]byte
+	keyDgst := r.keyDgst
+	if !skipKeys && !fixedKey {
+		if keyPEMs, keyDgst, res.Reason, err = r.readKeys(ctx); err != nil {
+			return
+		}
+	}
+
+	var staple []byte
+	var stapleDgst uint64
+	if r.stapleSrc != nil {
+		if staple, stapleDgst, err = r.load(ctx, r.stapleSrc); err != nil {
+			res.Reason = reasonReadFailed
+			return
+		}
+	}
+	var issuerHint []byte
+	var issuerDgst uint64
+	if (r.stapleSrc != nil || r.stapleFetch != nil) && r.issuerSrc != nil {
+		if issuerHint, issuerDgst, err = r.load(ctx, r.issuerSrc); err != nil {
+			res.Reason = reasonReadFailed
+			return
+		}
+	}
+
+	caPEM, caDgst, err := r.load(ctx, r.caSrc)
 	if err != nil {
+		res.Reason = reasonReadFailed
 		return
 	}
 
-	keyPEM, keyDgst, err := load(r.keyPath)
+	passphrase, passDgst, err := r.load(ctx, r.passSrc)
 	if err != nil {
+		res.Reason = reasonReadFailed
 		return
 	}
+	defer zero(passphrase)
 
-	if isReload && certDgst == r.certDgst && keyDgst == r.keyDgst {
+	var keyPEM []byte
+	pairChanged := certDgst != r.certDgst || keyDgst != r.keyDgst
+	if r.compare != nil {
+		keyPEM = bytes.Join(keyPEMs, nil)
+		defer zero(keyPEM)
+		if isReload && r.prevCertPEM != nil { // nil after ResetCache
+			pairChanged = r.compare(r.prevCertPEM, r.prevKeyPEM, certPEM, keyPEM)
+		}
+	}
+	if isReload && !pairChanged &&
+		stapleDgst == r.stapleDgst && issuerDgst == r.issuerDgst && caDgst == r.caDgst &&
+		passDgst == r.passDgst && chainDgst == r.chainDgst {
+		r.certStamp = certStamp
+		r.keyStamp = keyStamp
+		r.triggerStamp, r.forceNext = triggerStamp, false
+		r.setGeneration(gen, genValid)
+		if skipKeys {
+			r.keySkips++
+		} else {
+			r.keySkips = 0
+		}
+		r.lastOK.Store(r.now())
+		res.Reason = reasonUnchanged
 		return
 	}
+	res.detected = true
+	if skipKeys {
+		if keyPEMs, keyDgst, res.Reason, err = r.readKeys(ctx); err != nil {
+			return
+		}
+	}
+	r.keySkips = 0
+	certFilePEM := certPEM
+	if len(r.chainSrcs) > 0 {
+		certPEM = append(append(certPEM, '\n'), chainPEM...)
+	}
 
-	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if r.preParse != nil && fixedKey {
+		if err = r.preParse(certPEM, nil); err != nil {
+			res.Reason = reasonRejected
+			return
+		}
+	} else if r.preParse != nil {
+		for _, keyPEM := range keyPEMs {
+			if keyPEM == nil {
+				continue
+			}
+			if err = r.preParse(certPEM, keyPEM); err != nil {
+				res.Reason = reasonRejected
+				return
+			}
+		}
+	}
+
+	if r.passSrc != nil {
+		if keyPEMs, err = decryptKeys(keyPEMs, passphrase); err != nil {
+			res.Reason = reasonRejected
+			return
+		}
+		defer func() {
+			for _, keyPEM := range keyPEMs {
+				zero(keyPEM)
+			}
+		}()
+	}
+
+	var certs []tls.Certificate
+	if _, isSigner := r.keySrc.(signerSource); r.parseCache != nil && !isSigner {
+		dgsts := [4]uint64{certDgst, keyDgst, chainDgst, passDgst}
+		var warnings []error
+		certs, warnings, err = r.parseCache.parse(r.cacheName(), dgsts, func() ([]tls.Certificate, []error, error) {
+			var warnings []error
+			certs, err := r.parse(certPEM, keyPEMs, &warnings)
+			return certs, warnings, err
+		})
+		res.warnings = append(res.warnings, warnings...)
+	} else {
+		certs, err = r.parse(certPEM, keyPEMs, &res.warnings)
+	}
 	if err != nil {
+		res.Reason = reasonRejected
 		return
 	}
+	res.candidate = certs[0].Leaf
+	for i := range certs {
+		warnings, err := r.validate(&certs[i])
+		if err != nil {
+			res.warnings = nil
+			res.Reason = reasonRejected
+			return res, err
+		}
+		res.warnings = append(res.warnings, warnings...)
+	}
+	cert := certs[0]
+	cert.OCSPStaple = staple
+	var ocspIssuer *x509.Certificate
+	if issuerHint != nil {
+		if ocspIssuer, err = parseIssuerHint(issuerHint); err != nil {
+			res.warnings = append(res.warnings, fmt.Errorf("%s: ignored OCSP issuer: %w", r.issuerSrc.name(), err))
+			ocspIssuer, err = nil, nil
+		}
+	}
+	res.warnings = append(res.warnings, checkStaple(&cert, ocspIssuer, r.now())...)
+	snap := &snapshot{cert: &cert, notAfter: cert.Leaf.NotAfter.Unix(), ocspIssuer: ocspIssuer}
+	for i := range certs[1:] {
+		snap.alts = append(snap.alts, &certs[1+i])
+	}
+	if r.caSrc != nil {
+		if snap.clientCAs, err = parseCAs(trimBOM(caPEM)); err != nil {
+			res.Reason = reasonRejected
+			return
+		}
+	}
+	snap.config = r.newConfig(snap)
+	if r.veto != nil && isReload {
+		if err = r.veto(r.Leaf(), cert.Leaf); err != nil {
+			err = fmt.Errorf("rotation vetoed: %w", err)
+			res.warnings = nil
+			res.Reason = reasonVetoed
+			return
+		}
+	}
 
+	if isReload && r.swapWindow > 0 && !r.forceSwap {
+		if old := r.Leaf(); old != nil && r.now().Before(old.NotAfter.Add(-r.swapWindow)) {
+			// Digests and stamps are left alone, so that the next reload
+			// reads the files again.
+			r.lastOK.Store(r.now())
+			res.Reason = reasonDeferred
+			return
+		}
+	}
+
+	if isReload && r.dryRun {
+		// Digests and stamps are left alone, so that the change keeps being
+		// reported until the files are back to the installed ones.
+		r.lastOK.Store(r.now())
+		res.Reason = reasonWouldInstall
+		return
+	}
 	r.certDgst = certDgst
 	r.keyDgst = keyDgst
+	if r.compare != nil {
+		zero(r.prevKeyPEM)
+		r.prevCertPEM = append([]byte(nil), certFilePEM...)
+		r.prevKeyPEM = append([]byte(nil), keyPEM...)
+	}
+	r.stapleDgst = stapleDgst
+	r.issuerDgst = issuerDgst
+	r.caDgst = caDgst
+	r.chainDgst = chainDgst
+	r.passDgst = passDgst
+	r.triggerStamp, r.forceNext = triggerStamp, false
+	r.setGeneration(gen, genValid)
+	r.certStamp = certStamp
+	r.keyStamp = keyStamp
+	if r.pinned {
+		r.lastOK.Store(r.now())
+		res.Reason = reasonPinned
+		return
+	}
 	atomic.StorePointer(
-		(*unsafe.Pointer)(unsafe.Pointer(&r.cert)),
-		unsafe.Pointer(&cert),
+		(*unsafe.Pointer)(unsafe.Pointer(&r.snap)),
+		unsafe.Pointer(snap),
 	)
+	r.lastOK.Store(r.now())
+	r.lastSwap.Store(r.now())
+	r.broadcastInstalled()
+	if isReload && r.stapleNow != nil {
+		select {
+		case r.stapleNow <- struct{}{}:
+		default:
+		}
+	}
+	res.Changed = true
+	res.Reason = reasonInstalled
 	return
 }
 
-// Get currently loaded tls.Certificate.
+// parse builds a tls.Certificate with Leaf populated, or several of them for
+// NewFromBundle. keyPEMs are ignored in certificate-only mode. Problems not
+// preventing installation are appended to warnings.
+func (r *Reloader) parse(certPEM []byte, keyPEMs [][]byte, warnings *[]error) ([]tls.Certificate, error) {
+	if r.bundle {
+		return parseBundle(certPEM)
+	}
+	var (
+		cert tls.Certificate
+		err  error
+	)
+	ks, isSigner := r.keySrc.(signerSource)
+	if r.keySrc == nil || isSigner || r.fixedKey != nil {
+		cert, err = parseCertificates(certPEM)
+	} else {
+		cert, err = r.pairKeys(certPEM, keyPEMs, warnings)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	if r.fixedKey != nil {
+		cert.PrivateKey = r.fixedKey
+	} else if isSigner {
+		if cert.PrivateKey, err = ks.signer(cert.Leaf); err != nil {
+			return nil, err
+		}
+	}
+	if cert.PrivateKey != nil {
+		if err = checkKeyMatch(&cert); err != nil {
+			return nil, err
+		}
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// CertPath returns the resolved path of certificate being reloaded. For a
+// Reloader created by NewFromFiles, it returns the name of certificate file.
+func (r *Reloader) CertPath() string {
+	r.pathMu.RLock()
+	defer r.pathMu.RUnlock()
+	return r.certSrc.name()
+}
+
+// KeyPath returns the resolved path of private key being reloaded. For a
+// Reloader created by NewFromFiles, it returns the name of private key file.
+// It returns an empty string in certificate-only mode.
+func (r *Reloader) KeyPath() string {
+	if r.certOnly {
+		return ""
+	}
+	r.pathMu.RLock()
+	defer r.pathMu.RUnlock()
+	return r.keySrc.name()
+}
+
+// Get currently loaded tls.Certificate. It returns nil in certificate-only
+// mode. Get is lock-free and does not allocate, so it is cheap enough to be
+// called on every handshake. The returned tls.Certificate is shared with all
+// other callers and concurrent handshakes, and must not be modified; use
+// GetCopy if you need to.
 func (r *Reloader) Get() *tls.Certificate {
-	return (*tls.Certificate)(atomic.LoadPointer(
-		(*unsafe.Pointer)(unsafe.Pointer(&r.cert))))
+	if r.certOnly {
+		return nil
+	}
+	return r.current()
+}
+
+// GetCopy returns a copy of currently loaded tls.Certificate, which the caller
+// is free to modify, or nil in certificate-only mode. All slices are copied
+// deeply, while PrivateKey and Leaf are still shared and must not be modified.
+func (r *Reloader) GetCopy() *tls.Certificate {
+	cert := r.Get()
+	if cert == nil {
+		return nil
+	}
+	c := *cert
+	c.Certificate = make([][]byte, len(cert.Certificate))
+	for i, der := range cert.Certificate {
+		c.Certificate[i] = append([]byte(nil), der...)
+	}
+	c.OCSPStaple = append([]byte(nil), cert.OCSPStaple...)
+	if cert.SignedCertificateTimestamps != nil {
+		c.SignedCertificateTimestamps = make([][]byte, len(cert.SignedCertificateTimestamps))
+		for i, sct := range cert.SignedCertificateTimestamps {
+			c.SignedCertificateTimestamps[i] = append([]byte(nil), sct...)
+		}
+	}
+	c.SupportedSignatureAlgorithms = append([]tls.SignatureScheme(nil), cert.SupportedSignatureAlgorithms...)
+	return &c
+}
+
+// current returns currently loaded tls.Certificate, which has no PrivateKey in
+// certificate-only mode.
+func (r *Reloader) current() *tls.Certificate {
+	if snap := r.snapshot(); snap != nil {
+		return snap.cert
+	}
+	return nil
+}
+
+func (r *Reloader) snapshot() *snapshot {
+	return (*snapshot)(atomic.LoadPointer(
+		(*unsafe.Pointer)(unsafe.Pointer(&r.snap))))
+}
+
+// GetCertificate returns currently loaded tls.Certificate, or one registered
+// by SetALPNCertificate or SetServerNameConfig. It can be used as
+// tls.Config.GetCertificate directly. It fails in certificate-only mode. In
+// order of precedence, it returns
+//
+//  1. the certificate for an ALPN protocol offered by the client,
+//  2. the certificate for the requested server name,
+//  3. the last successfully loaded certificate while it is valid, regardless
+//     of failures of later reloads, or that of a pair of WithAdditionalPair
+//     better supported by the client,
+//  4. the fallback given to WithExpiredFallback once that expired,
+//  5. an error once the grace period of WithStrictExpiry has elapsed, failing
+//     the handshake,
+//  6. the expired certificate otherwise.
+func (r *Reloader) GetCertificate(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if r.certOnly {
+		return nil, errCertOnly
+	}
+	if _, cert := r.alpnCertificate(chi); cert != nil {
+		return cert, nil
+	}
+	if o, _ := r.nameOverride(chi); o.cert != nil {
+		return o.cert, nil
+	}
+	owner, cert := r.selectPair(chi)
+	return owner.checkExpiry(cert)
+}
+
+// now returns the current time of the clock set by WithClock.
+func (r *Reloader) now() time.Time {
+	if r.clock != nil {
+		return r.clock()
+	}
+	return time.Now()
+}
+
+// checkExpiry returns the certificate to serve in place of the loaded cert,
+// which is replaced by the fallback once expired, or fails if it should not
+// be served due to WithStrictExpiry.
+func (r *Reloader) checkExpiry(cert *tls.Certificate) (*tls.Certificate, error) {
+	if r.fallback == nil && !r.strictExpiry {
+		return cert, nil
+	}
+	now := r.now()
+	if r.fallback != nil && now.After(cert.Leaf.NotAfter) {
+		return r.fallback, nil
+	}
+	if r.strictExpiry && now.After(cert.Leaf.NotAfter.Add(r.expiryGrace)) {
+		return nil, errCertExpired
+	}
+	return cert, nil
+}
+
+// sources returns all configured sources for in-place modification.
+func (r *Reloader) sources() []*source {
+	srcs := []*source{&r.certSrc, &r.keySrc, &r.stapleSrc, &r.issuerSrc, &r.caSrc, &r.passSrc, &r.triggerSrc, &r.genSrc}
+	for i := range r.keyAlts {
+		srcs = append(srcs, &r.keyAlts[i])
+	}
+	for i := range r.chainSrcs {
+		srcs = append(srcs, &r.chainSrcs[i])
+	}
+	return srcs
 }
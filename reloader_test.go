@@ -33,3 +33,16 @@ func Example() {
 	err = server.ListenAndServeTLS("", "")
 	log.Fatal(err)
 }
+
+func ExampleReloader_TLSConfig() {
+	reloader, err := certreloader.New("path/to/fullchain.pem", "path/to/privkey.pem", 5*time.Minute,
+		certreloader.WithTLSPreset(certreloader.PresetIntermediate))
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := http.Server{
+		Addr:      "localhost:8443",
+		TLSConfig: reloader.TLSConfig(),
+	}
+	log.Fatal(server.ListenAndServeTLS("", ""))
+}
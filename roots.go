@@ -0,0 +1,32 @@
+package certreloader
+
+import (
+	"crypto/x509"
+	"fmt"
+)
+
+// checkRoots verifies currently loaded chain against roots, or the system
+// pool if roots is nil, and returns a warning if it does not verify.
+func (r *Reloader) checkRoots() []error {
+	cert := r.current()
+	if cert == nil || cert.Leaf == nil {
+		return nil
+	}
+	opts := x509.VerifyOptions{
+		Roots:         r.roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   r.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, der := range cert.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return []error{fmt.Errorf("%s: %w", r.CertPath(), err)}
+		}
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := cert.Leaf.Verify(opts); err != nil {
+		return []error{fmt.Errorf("%s: certificate no longer verifies: %w", r.CertPath(), err)}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package certreloader
+
+import (
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRootsCheck(t *testing.T) {
+	var warnings []error
+	trusted := x509.NewCertPool()
+	r := newTestReloader(t, WithRootsCheck(trusted), WithOnWarning(func(err error) {
+		warnings = append(warnings, err)
+	}))
+	defer r.Stop()
+
+	r.tick()
+	if len(warnings) != 1 {
+		t.Fatalf("got %v for untrusted certificate", warnings)
+	}
+	trusted.AddCert(r.Leaf())
+	r.tick()
+	if len(warnings) != 1 {
+		t.Errorf("got %v for trusted certificate", warnings[1:])
+	}
+}
+
+func TestRotationWarning(t *testing.T) {
+	var warnings []error
+	now := time.Now()
+	r := newTestReloader(t, WithRotationWarning(60*24*time.Hour), WithClock(func() time.Time { return now }),
+		WithOnWarning(func(err error) { warnings = append(warnings, err) }))
+	defer r.Stop()
+
+	now = now.Add(59 * 24 * time.Hour)
+	r.tick()
+	if len(warnings) != 0 {
+		t.Fatalf("got %v before threshold", warnings)
+	}
+	now = now.Add(2 * 24 * time.Hour)
+	r.tick()
+	if len(warnings) != 1 || !errors.Is(warnings[0], errNotRotated) {
+		t.Fatalf("got %v, want %v", warnings, errNotRotated)
+	}
+	writeTestPair(t, filepath.Dir(r.CertPath()), "example")
+	r.tick()
+	if len(warnings) != 1 {
+		t.Errorf("got %v after rotation", warnings[1:])
+	}
+}
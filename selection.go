@@ -0,0 +1,87 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"errors"
+	"sort"
+	"sync/atomic"
+)
+
+var errNoCertificate = errors.New("no registered certificate supports the client")
+
+// maxSelections bounds the number of distinct pairs of name and server name
+// counted by Manager.GetCertificate, since server names are chosen by clients,
+// e.g. matching a wildcard certificate.
+const maxSelections = 1024
+
+// OtherServerNames replaces server names in SelectionStats once too many
+// distinct ones were seen.
+const OtherServerNames = "(other)"
+
+// SelectionStat counts handshakes for which Manager.GetCertificate selected
+// the pair registered under Name for ServerName requested by the client. An
+// empty Name counts handshakes supported by no pair; an empty ServerName
+// counts clients not sending SNI.
+type SelectionStat struct {
+	Name       string
+	ServerName string
+	Count      uint64
+}
+
+type selectionKey struct {
+	name       string
+	serverName string
+}
+
+// GetCertificate selects the first registered pair in order of name whose
+// currently loaded certificate supports chi as by
+// tls.ClientHelloInfo.SupportsCertificate, e.g. covering the requested server
+// name, and counts the selection for SelectionStats. It can be used as
+// tls.Config.GetCertificate directly. Each Reloader serves its certificate
+// as by Reloader.GetCertificate. It fails if no pair supports chi.
+func (m *Manager) GetCertificate(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	for _, e := range m.snapshot() {
+		cert, err := e.r.GetCertificate(chi)
+		if err != nil || chi.SupportsCertificate(cert) != nil {
+			continue
+		}
+		m.countSelection(e.name, chi.ServerName)
+		return cert, nil
+	}
+	m.countSelection("", chi.ServerName)
+	return nil, errNoCertificate
+}
+
+func (m *Manager) countSelection(name, serverName string) {
+	key := selectionKey{name, serverName}
+	c, ok := m.selections.Load(key)
+	if !ok {
+		if m.numSelections.Load() >= maxSelections {
+			key.serverName = OtherServerNames
+		}
+		var loaded bool
+		if c, loaded = m.selections.LoadOrStore(key, new(atomic.Uint64)); !loaded {
+			m.numSelections.Add(1)
+		}
+	}
+	c.(*atomic.Uint64).Add(1)
+}
+
+// SelectionStats returns counts of selections by GetCertificate since
+// NewManager, ordered by name and server name. Counts of removed pairs are
+// retained.
+func (m *Manager) SelectionStats() []SelectionStat {
+	var stats []SelectionStat
+	m.selections.Range(func(k, v interface{}) bool {
+		key := k.(selectionKey)
+		stats = append(stats, SelectionStat{key.name, key.serverName, v.(*atomic.Uint64).Load()})
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Name != stats[j].Name {
+			return stats[i].Name < stats[j].Name
+		}
+		return stats[i].ServerName < stats[j].ServerName
+	})
+	return stats
+}
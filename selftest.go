@@ -0,0 +1,81 @@
+package certreloader
+
+import (
+	"context"
+	"fmt"
+)
+
+// SelfTest reads and parses the files currently in place like a reload, and
+// returns an error if they no longer form a valid certificate / private key
+// pair, e.g. due to silent corruption, a half-written file or a key that no
+// longer matches. Validation given by options is applied as well. Nothing is
+// installed and no state of r changes, so it is suited as a deep readiness
+// probe catching problems before the next rotation. Files that form a valid
+// pair differing from the served one pass, since they are just pending
+// installation. It keeps working after Stop.
+func (r *Reloader) SelfTest() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx := context.Background()
+	if r.reloadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.reloadTimeout)
+		defer cancel()
+	}
+
+	certPEM, _, err := r.load(ctx, r.certSrc)
+	if err != nil {
+		return fmt.Errorf("self-test: %w", err)
+	}
+	chainPEM, _, err := r.loadChain(ctx)
+	if err != nil {
+		return fmt.Errorf("self-test: %w", err)
+	}
+	certPEM = trimBOM(certPEM)
+	if r.pkcs7 {
+		certPEM, err = pkcs7ToPEM(r.certSrc, certPEM)
+	} else {
+		err = checkComplete(r.certSrc, certPEM)
+	}
+	if err != nil {
+		return fmt.Errorf("self-test: %w", err)
+	}
+	if len(r.chainSrcs) > 0 {
+		certPEM = append(append(certPEM, '\n'), chainPEM...)
+	}
+
+	var keyPEMs [][]byte
+	if r.fixedKey == nil {
+		if keyPEMs, _, _, err = r.readKeys(ctx); err != nil {
+			return fmt.Errorf("self-test: %w", err)
+		}
+	}
+	if r.passSrc != nil {
+		passphrase, _, err := r.load(ctx, r.passSrc)
+		if err != nil {
+			return fmt.Errorf("self-test: %w", err)
+		}
+		defer zero(passphrase)
+		if keyPEMs, err = decryptKeys(keyPEMs, passphrase); err != nil {
+			return fmt.Errorf("self-test: %w", err)
+		}
+		defer func() {
+			for _, keyPEM := range keyPEMs {
+				zero(keyPEM)
+			}
+		}()
+	}
+
+	var warnings []error
+	certs, err := r.parse(certPEM, keyPEMs, &warnings)
+	if err != nil {
+		return fmt.Errorf("self-test: %w", err)
+	}
+	for i := range certs {
+		if _, err = r.validate(&certs[i]); err != nil {
+			return fmt.Errorf("self-test: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package certreloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelfTest(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	r, err := New(certPath, keyPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if err = r.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	certPEM := mustReadTestFile(t, certPath)
+
+	// A truncated certificate and a foreign key fail, leaving everything as
+	// it was.
+	writeTestFile(t, certPath, certPEM[:len(certPEM)/2])
+	if err = r.SelfTest(); err == nil {
+		t.Error("truncated certificate passed")
+	}
+	_, otherKeyPEM := newTestPair(t, "other")
+	writeTestFile(t, certPath, certPEM)
+	writeTestFile(t, keyPath, otherKeyPEM)
+	if err = r.SelfTest(); err == nil {
+		t.Error("mismatched key passed")
+	}
+	if stats := r.Stats(); stats.Attempts != 1 || stats.Failed != 0 || r.Get().Leaf.Subject.CommonName != "example" {
+		t.Errorf("self-test changed state: %+v", stats)
+	}
+
+	// A valid new pair passes without being installed, and is still detected
+	// by the next reload.
+	writeTestPair(t, dir, "rotated")
+	if err = r.SelfTest(); err != nil {
+		t.Fatal(err)
+	}
+	if cn := r.Get().Leaf.Subject.CommonName; cn != "example" {
+		t.Fatalf("self-test installed %q", cn)
+	}
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v after self-test", res, err)
+	}
+
+	// Validation options apply.
+	pinned, err := New(certPath, keyPath, time.Hour, WithPinnedFingerprints(r.fingerprint(r.Leaf())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pinned.Stop()
+	writeTestPair(t, dir, "unpinned")
+	if err = pinned.SelfTest(); err == nil {
+		t.Error("unpinned certificate passed")
+	}
+}
@@ -0,0 +1,47 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+// nameOverride is registered by SetServerNameConfig.
+type nameOverride struct {
+	cert      *tls.Certificate
+	configure func(*tls.Config)
+}
+
+// SetServerNameConfig registers a policy for clients requesting serverName via
+// SNI: GetConfigForClient clones the config it would return otherwise for
+// each such connection, and passes it to configure, e.g. to relax cipher
+// suites or minimum version for a legacy domain. If cert is not nil, it is
+// served to those clients instead of the reloaded certificate, also by
+// GetCertificate. Both nil remove the registration, taking effect for the
+// next handshake. Certificates registered by SetALPNCertificate or
+// SetChallengeCertificate take precedence.
+func (r *Reloader) SetServerNameConfig(serverName string, cert *tls.Certificate, configure func(*tls.Config)) {
+	serverName = strings.ToLower(serverName)
+	r.overrideMu.Lock()
+	defer r.overrideMu.Unlock()
+	old, _ := r.nameOverrides.Load().(map[string]nameOverride)
+	overrides := make(map[string]nameOverride, len(old)+1)
+	for n, o := range old {
+		overrides[n] = o
+	}
+	if cert != nil || configure != nil {
+		overrides[serverName] = nameOverride{cert, configure}
+	} else {
+		delete(overrides, serverName)
+	}
+	r.nameOverrides.Store(overrides)
+}
+
+// nameOverride returns the registration for the server name requested by chi.
+func (r *Reloader) nameOverride(chi *tls.ClientHelloInfo) (nameOverride, bool) {
+	overrides, _ := r.nameOverrides.Load().(map[string]nameOverride)
+	if len(overrides) == 0 || chi == nil || chi.ServerName == "" {
+		return nameOverride{}, false
+	}
+	o, ok := overrides[strings.ToLower(chi.ServerName)]
+	return o, ok
+}
@@ -0,0 +1,244 @@
+package certreloader
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cespare/xxhash"
+)
+
+// source is where certificate or private key is read from.
+type source interface {
+	// read returns the contents, failing with errFileTooLarge if there are
+	// more than limit bytes. A non-positive limit means no limit. Reading
+	// should be aborted once ctx is done.
+	read(ctx context.Context, limit int64) ([]byte, error)
+	// name identifies the source for diagnostics.
+	name() string
+}
+
+// stamper is implemented by sources able to summarize their metadata cheaply.
+// Reading is skipped if neither stamp of certificate and private key changed
+// since last successful reload.
+type stamper interface {
+	stamp() (fileStamp, error)
+}
+
+// absPather is implemented by sources reading from a path, which is converted
+// to absolute form unless WithRelativePaths is given.
+type absPather interface {
+	abs() (source, error)
+}
+
+// signerSource is implemented by private key sources whose keys cannot be
+// read, such as those of a platform key store. read returns the certificate
+// the key is bound to, and signer returns the key for its parsed leaf.
+type signerSource interface {
+	signer(leaf *x509.Certificate) (crypto.Signer, error)
+}
+
+// fileStamp summarizes file metadata. Besides size and modification time, it
+// includes device / inode numbers, so that replacement by another file always
+// forces a read, and inode change time, which also changes on writes that
+// preserve modification time. The latter are only available on some platforms.
+type fileStamp struct {
+	size  int64
+	mtime int64
+	dev   uint64
+	ino   uint64
+	ctime int64
+}
+
+func newFileStamp(fi os.FileInfo) fileStamp {
+	s := fileStamp{size: fi.Size(), mtime: fi.ModTime().UnixNano()}
+	sysStamp(fi, &s)
+	return s
+}
+
+// pathSource reads from a file path on each reload.
+type pathSource string
+
+func (p pathSource) read(ctx context.Context, limit int64) ([]byte, error) {
+	f, err := os.Open(string(p))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readAll(ctx, f, limit)
+}
+
+func (p pathSource) name() string {
+	return string(p)
+}
+
+// stamp stats the file p refers to, following symbolic links, so that
+// replacing the file by rename, or repointing a link to it, changes the stamp
+// by device / inode number even if size and modification time are the same.
+func (p pathSource) stamp() (fileStamp, error) {
+	fi, err := os.Stat(string(p))
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return newFileStamp(fi), nil
+}
+
+func (p pathSource) abs() (source, error) {
+	abs, err := filepath.Abs(string(p))
+	if err != nil {
+		return nil, err
+	}
+	return pathSource(abs), nil
+}
+
+// fileSource re-reads an already opened file from its beginning on each
+// reload, without moving its offset.
+type fileSource struct {
+	f *os.File
+}
+
+func (s fileSource) read(ctx context.Context, limit int64) ([]byte, error) {
+	return readAll(ctx, io.NewSectionReader(s.f, 0, math.MaxInt64), limit)
+}
+
+func (s fileSource) name() string {
+	return s.f.Name()
+}
+
+func (s fileSource) stamp() (fileStamp, error) {
+	fi, err := s.f.Stat()
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return newFileStamp(fi), nil
+}
+
+var errFileTooLarge = errors.New("file exceeds size limit")
+
+// readAll reads rd until EOF like ioutil.ReadAll, but stops after limit bytes
+// if limit is positive, so that a huge file is never buffered as a whole. It
+// is aborted between chunks once ctx is done.
+func readAll(ctx context.Context, rd io.Reader, limit int64) ([]byte, error) {
+	if limit > 0 {
+		rd = io.LimitReader(rd, limit+1)
+	}
+	data := make([]byte, 0, 512)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(data) == cap(data) {
+			data = append(data, 0)[:len(data)]
+		}
+		n, err := rd.Read(data[len(data):cap(data)])
+		data = data[:len(data)+n]
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, errFileTooLarge
+	}
+	return data, nil
+}
+
+// load reads src and computes its digest. Changes are detected by comparing
+// digests with those of last successful reload, so neither the cost of
+// comparison nor memory retained depends on file size, and no key material is
+// kept around. Nothing is read from a nil src. Reading fails if src is larger
+// than r.maxFileSize.
+func (r *Reloader) load(ctx context.Context, src source) (data []byte, dgst uint64, err error) {
+	if src == nil {
+		return
+	}
+	if p, ok := src.(pathSource); ok && r.readFile != nil {
+		if data, err = r.readFile(string(p)); err == nil && r.maxFileSize > 0 && int64(len(data)) > r.maxFileSize {
+			data, err = nil, errFileTooLarge
+		}
+		if err == nil {
+			err = ctx.Err()
+		}
+	} else {
+		data, err = src.read(ctx, r.maxFileSize)
+	}
+	if err == errFileTooLarge {
+		err = fmt.Errorf("%s: %w of %d bytes", src.name(), err, r.maxFileSize)
+	} else if err != nil && err == ctx.Err() {
+		err = fmt.Errorf("%s: %w", src.name(), err)
+	}
+	if err != nil {
+		return
+	}
+	dgst = r.digest(data)
+	return
+}
+
+// digest computes the digest of data for change detection, by the hash given
+// to WithChangeHash.
+func (r *Reloader) digest(data []byte) uint64 {
+	if r.changeHash == nil {
+		return xxhash.Sum64(data)
+	}
+	h := r.changeHash()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// racyStampWindow is how long after its modification a stamp is racy:
+// another write of the same size within the same tick of a coarse file system
+// timestamp, e.g. of 2 seconds on FAT, would keep it unchanged.
+const racyStampWindow = 2 * time.Second
+
+// stampOf returns the stamp of src, and whether src supports stamping at all.
+// A nil src has a constant stamp. Paths are only stamped where sysStamp is
+// available, since a file rewritten in place may keep its size and
+// modification time, and never once reading of paths is replaced. A path
+// failing to stat is not stamped, leaving it to reading to report the failure,
+// which may be tolerated, e.g. for a candidate of NewWithKeys. Racy stamps are
+// not stamped either, so that the file is read until its stamp settles.
+func (r *Reloader) stampOf(src source) (stamp fileStamp, ok bool, err error) {
+	if src == nil {
+		ok = true
+		return
+	}
+	if p, isPath := src.(pathSource); isPath {
+		if !haveSysStamp || r.readFile != nil {
+			return
+		}
+		if stamp, err = p.stamp(); err != nil {
+			return fileStamp{}, false, nil
+		}
+	} else {
+		s, isStamper := src.(stamper)
+		if !isStamper {
+			return
+		}
+		if stamp, err = s.stamp(); err != nil {
+			return
+		}
+	}
+	if r.racy(stamp) {
+		return fileStamp{}, false, nil
+	}
+	return stamp, true, nil
+}
+
+// racy reports whether s was modified or changed within the racy window of
+// now, by real time rather than the clock of WithClock.
+func (r *Reloader) racy(s fileStamp) bool {
+	changed := s.mtime
+	if s.ctime > changed {
+		changed = s.ctime
+	}
+	return time.Now().UnixNano()-changed < int64(r.racyWindow)
+}
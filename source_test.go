@@ -0,0 +1,386 @@
+package certreloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadFaults(t *testing.T) {
+	var fault func(path string, data []byte) ([]byte, error)
+	r := newTestReloader(t, WithOnError(func(error) {}), withReadFile(func(path string) ([]byte, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil || fault == nil {
+			return data, err
+		}
+		return fault(path, data)
+	}))
+	defer r.Stop()
+	old := r.Get()
+	for _, tt := range []struct {
+		name   string
+		fault  func(path string, data []byte) ([]byte, error)
+		reason string
+		err    error
+	}{
+		{"permission denied", func(path string, _ []byte) ([]byte, error) {
+			return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrPermission}
+		}, reasonReadFailed, os.ErrPermission},
+		{"partial read", func(_ string, data []byte) ([]byte, error) {
+			return data[:len(data)/2], nil
+		}, reasonIncomplete, ErrIncompleteFile},
+		{"empty", func(string, []byte) ([]byte, error) {
+			return nil, nil
+		}, reasonIncomplete, ErrIncompleteFile},
+		{"mismatch", func(path string, data []byte) ([]byte, error) {
+			if path != r.KeyPath() {
+				return data, nil
+			}
+			_, keyPEM := newTestPair(t, "other")
+			return keyPEM, nil
+		}, reasonRejected, nil},
+	} {
+		fault = tt.fault
+		res, err := r.Reload()
+		if err == nil || res.Reason != tt.reason || (tt.err != nil && !errors.Is(err, tt.err)) {
+			t.Errorf("%s: got %q, %v", tt.name, res.Reason, err)
+		}
+		if r.Get() != old {
+			t.Errorf("%s: certificate replaced", tt.name)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	r := newTestReloader(t, WithMaxFileSize(4096), WithMaxChainLength(2))
+	defer r.Stop()
+	certPEM := mustReadTestFile(t, r.CertPath())
+	for _, tt := range []struct {
+		n    int
+		want error
+	}{
+		{2, nil},
+		{3, errChainTooLong},
+		{100, errFileTooLarge},
+	} {
+		writeTestFile(t, r.CertPath(), bytes.Repeat(certPEM, tt.n))
+		if _, err := r.Reload(); !errors.Is(err, tt.want) {
+			t.Errorf("chain of %d: got %v, want %v", tt.n, err, tt.want)
+		}
+	}
+}
+
+// BenchmarkReloadUnchanged measures a reload that finds nothing changed, with
+// certificate bundles of various sizes.
+func BenchmarkReloadUnchanged(b *testing.B) {
+	for _, n := range []int{1, 100, 1000} {
+		b.Run(fmt.Sprintf("chain=%d", n), func(b *testing.B) {
+			r := newTestReloader(b)
+			defer r.Stop()
+			certPEM := mustReadTestFile(b, r.CertPath())
+			writeTestFile(b, r.CertPath(), bytes.Repeat(certPEM, n))
+			if _, err := r.Reload(); err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(n * len(certPEM)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if res, _ := r.Reload(); res.Changed {
+					b.Fatal("unexpected change")
+				}
+			}
+		})
+	}
+}
+
+func TestIncompleteRetry(t *testing.T) {
+	reloaded := make(chan struct{}, 1)
+	var errs []error
+	r := newTestReloader(t, WithIncompleteRetry(10*time.Millisecond),
+		WithOnError(func(err error) { errs = append(errs, err) }),
+		WithOnReload(func(*tls.Certificate) { reloaded <- struct{}{} }))
+	defer r.Stop()
+
+	certPath, keyPath := r.CertPath(), r.KeyPath()
+	writeTestFile(t, certPath, nil)
+	r.tick()
+	if len(errs) != 1 || !errors.Is(errs[0], ErrIncompleteFile) {
+		t.Fatalf("got %v, want %v", errs, ErrIncompleteFile)
+	}
+	certPEM, keyPEM := newTestPair(t, "example")
+	writeTestFile(t, keyPath, keyPEM)
+	writeTestFile(t, certPath, certPEM)
+	select {
+	case <-reloaded:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no retry after incomplete file")
+	}
+}
+
+func TestIncompleteRetryBounded(t *testing.T) {
+	r := newTestReloader(t, WithIncompleteRetry(20*time.Millisecond), WithOnError(func(error) {}))
+	defer r.Stop()
+	writeTestFile(t, r.CertPath(), nil)
+
+	// Ticks hitting the incomplete file share a single retry timer, so five
+	// of them retry about once per 20ms, not five times.
+	for i := 0; i < 5; i++ {
+		r.tick()
+	}
+	before := r.Stats().Attempts
+	time.Sleep(200 * time.Millisecond)
+	if n := r.Stats().Attempts - before; n > 20 {
+		t.Errorf("got %d attempts in 200ms retrying every 20ms", n)
+	}
+	r.Stop()
+	time.Sleep(50 * time.Millisecond)
+	before = r.Stats().Attempts
+	time.Sleep(100 * time.Millisecond)
+	if n := r.Stats().Attempts - before; n != 0 {
+		t.Errorf("got %d attempts after Stop", n)
+	}
+}
+
+// hangingSource is a certificate source whose reads hang until canceled once
+// hang is set, like one on a stuck network file system.
+type hangingSource struct {
+	path pathSource
+	hang *atomic.Bool
+}
+
+func (s hangingSource) read(ctx context.Context, limit int64) ([]byte, error) {
+	if s.hang.Load() {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.path.read(ctx, limit)
+}
+
+func (s hangingSource) name() string {
+	return s.path.name()
+}
+
+func TestReloadCancel(t *testing.T) {
+	certPath, keyPath := writeTestPair(t, t.TempDir(), "example")
+	src := hangingSource{pathSource(certPath), new(atomic.Bool)}
+	r, err := newReloader(src, pathSource(keyPath), time.Hour, []Option{
+		WithRelativePaths(), WithReloadTimeout(10 * time.Millisecond), WithOnError(func(error) {}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := r.Get()
+
+	src.hang.Store(true)
+	res, err := r.Reload()
+	if !errors.Is(err, context.DeadlineExceeded) || res.Reason != reasonReadFailed {
+		t.Errorf("got %q, %v, want %q, %v", res.Reason, err, reasonReadFailed, context.DeadlineExceeded)
+	}
+	if r.Get() != old {
+		t.Error("certificate replaced by timed out reload")
+	}
+
+	// Stop aborts background reloads.
+	r.reloadTimeout = 0
+	done := make(chan error)
+	go func() {
+		_, err := r.reload(r.ctx, true)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	r.Stop()
+	select {
+	case err = <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop did not abort reload")
+	}
+	if r.Get() != old {
+		t.Error("certificate replaced by canceled reload")
+	}
+
+	// Explicit calls keep reading after Stop.
+	src.hang.Store(false)
+	if err = r.SelfTest(); err != nil {
+		t.Errorf("SelfTest after Stop: %v", err)
+	}
+	if _, err = r.Reload(); err != nil {
+		t.Errorf("Reload after Stop: %v", err)
+	}
+}
+
+func TestChangeComparator(t *testing.T) {
+	var calls int
+	r := newTestReloader(t, WithChangeComparator(func(oldCert, oldKey, newCert, newKey []byte) bool {
+		calls++
+		return !bytes.Equal(bytes.TrimSpace(oldCert), bytes.TrimSpace(newCert)) ||
+			!bytes.Equal(bytes.TrimSpace(oldKey), bytes.TrimSpace(newKey))
+	}))
+	defer r.Stop()
+	certPEM := mustReadTestFile(t, r.CertPath())
+	writeTestFile(t, r.CertPath(), append(append([]byte("\n"), certPEM...), "\n\n"...))
+	if res, err := r.Reload(); err != nil || res.Changed {
+		t.Errorf("cosmetic rewrite: got %+v, %v, want no change", res, err)
+	}
+	certPEM, keyPEM := newTestPair(t, "example")
+	writeTestFile(t, r.CertPath(), certPEM)
+	writeTestFile(t, r.KeyPath(), keyPEM)
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Errorf("new pair: got %+v, %v, want new certificate", res, err)
+	}
+	if calls != 2 {
+		t.Errorf("comparator called %d times, want 2", calls)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	r := newTestReloader(t, WithDryRun())
+	defer r.Stop()
+	old := r.Get()
+	certPEM, keyPEM := mustReadTestFile(t, r.CertPath()), mustReadTestFile(t, r.KeyPath())
+
+	// A new pair is reported on each reload, and never served.
+	newCertPEM, newKeyPEM := newTestPair(t, "rotated")
+	writeTestFile(t, r.CertPath(), newCertPEM)
+	writeTestFile(t, r.KeyPath(), newKeyPEM)
+	for i := 0; i < 2; i++ {
+		res, err := r.Reload()
+		if err != nil || res.Changed || res.Reason != reasonWouldInstall || res.candidate.Subject.CommonName != "rotated" {
+			t.Fatalf("reload %d: got %+v, %v, want %q", i, res, err, reasonWouldInstall)
+		}
+		if r.Get() != old {
+			t.Fatal("certificate installed in dry run")
+		}
+	}
+
+	// Rejections are reported as usual.
+	writeTestFile(t, r.CertPath(), certPEM)
+	if res, err := r.Reload(); err == nil || res.Reason != reasonRejected {
+		t.Errorf("mismatched pair: got %+v, %v, want %q", res, err, reasonRejected)
+	}
+
+	writeTestFile(t, r.KeyPath(), keyPEM)
+	if res, err := r.Reload(); err != nil || res.Reason != reasonUnchanged {
+		t.Errorf("restored pair: got %+v, %v, want %q", res, err, reasonUnchanged)
+	}
+}
+
+func TestPathStamp(t *testing.T) {
+	if !haveSysStamp {
+		t.Skip("paths are not stamped on this platform")
+	}
+	r := newTestReloader(t, withRacyWindow(0))
+	defer r.Stop()
+	if res, err := r.Reload(); err != nil || !res.skipped {
+		t.Fatalf("got %+v, %v, want unchanged files skipped by stamp", res, err)
+	}
+
+	// Replacement by rename is noticed by inode, even with the same size and
+	// modification time.
+	fi, err := os.Stat(r.CertPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaceTestFile(t, r.CertPath(), mustReadTestFile(t, r.CertPath()))
+	if err = os.Chtimes(r.CertPath(), fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := r.Reload(); err != nil || res.skipped || res.Reason != reasonUnchanged {
+		t.Errorf("got %+v, %v, want replaced file read", res, err)
+	}
+}
+
+func TestNewFromFiles(t *testing.T) {
+	certPath, keyPath := writeTestPair(t, t.TempDir(), "example")
+	certFile, err := os.Open(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer certFile.Close()
+	keyFile, err := os.Open(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keyFile.Close()
+	r, err := NewFromFiles(certFile, keyFile, time.Hour, withRacyWindow(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if r.CertPath() != certPath {
+		t.Errorf("got %q, want %q", r.CertPath(), certPath)
+	}
+	if res, err := r.Reload(); err != nil || !res.skipped {
+		t.Errorf("got %+v, %v, want unchanged files skipped by stamp", res, err)
+	}
+
+	// Files rewritten in place are read again through the descriptors,
+	// whose offsets are left alone.
+	certPEM, keyPEM := newTestPair(t, "rotated")
+	writeTestFile(t, keyPath, keyPEM)
+	writeTestFile(t, certPath, certPEM)
+	if res, err := r.Reload(); err != nil || !res.Changed || r.Leaf().Subject.CommonName != "rotated" {
+		t.Fatalf("got %+v, %v after rewrite", res, err)
+	}
+	if off, err := certFile.Seek(0, io.SeekCurrent); err != nil || off != 0 {
+		t.Errorf("got offset %d, %v", off, err)
+	}
+
+	// Replacement by rename leaves the descriptors on the original files.
+	certPEM, keyPEM = newTestPair(t, "renamed")
+	replaceTestFile(t, keyPath, keyPEM)
+	replaceTestFile(t, certPath, certPEM)
+	if res, err := r.Reload(); err != nil || res.Changed {
+		t.Errorf("got %+v, %v after rename", res, err)
+	}
+
+	// A pipe cannot be re-read from the beginning.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	if _, err = NewFromFiles(pr, keyFile, time.Hour); err == nil {
+		t.Error("pipe accepted")
+	}
+	if _, err = NewFromFiles(nil, keyFile, time.Hour); err != errInvalidCertFile {
+		t.Errorf("got %v, want %v", err, errInvalidCertFile)
+	}
+}
+
+func TestRacyStamp(t *testing.T) {
+	if !haveSysStamp {
+		t.Skip("paths are not stamped on this platform")
+	}
+	r := newTestReloader(t)
+	defer r.Stop()
+
+	// Files modified just now are read, and their stamps are not recorded,
+	// since a rewrite within the same timestamp tick would keep them.
+	if res, err := r.Reload(); err != nil || res.skipped {
+		t.Fatalf("got %+v, %v, want racy files read", res, err)
+	}
+	if r.certStamp != (fileStamp{}) || r.keyStamp != (fileStamp{}) {
+		t.Error("racy stamps recorded")
+	}
+
+	// Once settled, unchanged files are skipped.
+	r.racyWindow = 0
+	if res, err := r.Reload(); err != nil || res.skipped {
+		t.Fatalf("got %+v, %v, want files read once settled", res, err)
+	}
+	if res, err := r.Reload(); err != nil || !res.skipped {
+		t.Fatalf("got %+v, %v, want settled files skipped by stamp", res, err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build linux || openbsd || dragonfly || solaris
+
+package certreloader
+
+import (
+	"os"
+	"syscall"
+)
+
+// haveSysStamp reports whether sysStamp fills in inode / change time.
+const haveSysStamp = true
+
+func sysStamp(fi os.FileInfo, s *fileStamp) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	s.dev = uint64(st.Dev)
+	s.ino = uint64(st.Ino)
+	s.ctime = st.Ctim.Nano()
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !openbsd && !dragonfly && !solaris && !darwin && !freebsd && !netbsd
+
+package certreloader
+
+import "os"
+
+// haveSysStamp reports whether sysStamp fills in inode / change time.
+const haveSysStamp = false
+
+// sysStamp is a no-op where inode / change time are unavailable; stamps then
+// rely on size and modification time only.
+func sysStamp(os.FileInfo, *fileStamp) {}
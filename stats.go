@@ -0,0 +1,85 @@
+package certreloader
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats are cumulative reload statistics since New. The initial load in New
+// is included.
+type Stats struct {
+	// Attempts is the number of reloads attempted, which is the sum of
+	// Installed, Unchanged and Failed.
+	Attempts uint64
+	// Installed is the number of reloads which installed a new certificate.
+	Installed uint64
+	// Unchanged is the number of reloads which found nothing changed, or
+	// nothing to install in dry run.
+	Unchanged uint64
+	// Failed is the number of reloads which could not read or rejected the
+	// files.
+	Failed uint64
+	// LastSuccess is the time of last reload without error, or of last tick
+	// skipped by Pause or a reload guard.
+	LastSuccess time.Time
+	// LastFailure is the time of last failed reload, or zero if none failed.
+	LastFailure time.Time
+}
+
+type stats struct {
+	installed   atomic.Uint64
+	unchanged   atomic.Uint64
+	failed      atomic.Uint64
+	lastFailure atomic.Value // time.Time
+	lastAction  atomic.Value // string
+}
+
+const (
+	actionSkippedStat   = "skipped-stat"
+	actionReadUnchanged = "read-unchanged"
+	actionReloaded      = "reloaded"
+	actionError         = "error"
+)
+
+// Stats returns cumulative reload statistics.
+func (r *Reloader) Stats() Stats {
+	s := Stats{
+		Installed:   r.stats.installed.Load(),
+		Unchanged:   r.stats.unchanged.Load(),
+		Failed:      r.stats.failed.Load(),
+		LastSuccess: r.lastSuccess(),
+	}
+	s.Attempts = s.Installed + s.Unchanged + s.Failed
+	s.LastFailure, _ = r.stats.lastFailure.Load().(time.Time)
+	return s
+}
+
+// count records the outcome of a reload.
+func (r *Reloader) count(res ReloadResult, err error) {
+	switch {
+	case err != nil:
+		r.stats.failed.Add(1)
+		r.stats.lastFailure.Store(r.now())
+		r.stats.lastAction.Store(actionError)
+	case res.Changed:
+		r.stats.installed.Add(1)
+		r.stats.lastAction.Store(actionReloaded)
+	default:
+		r.stats.unchanged.Add(1)
+		if res.skipped {
+			r.stats.lastAction.Store(actionSkippedStat)
+		} else {
+			r.stats.lastAction.Store(actionReadUnchanged)
+		}
+	}
+}
+
+// LastAction tells what the last reload did, for diagnosing change detection:
+// "skipped-stat" if files were not read since their metadata (or that of the
+// trigger file) was unchanged, "read-unchanged" if they were read but found
+// unchanged, "reloaded" if a new certificate was installed, or "error". Ticks
+// skipped by Pause or a reload guard leave it unchanged.
+func (r *Reloader) LastAction() string {
+	action, _ := r.stats.lastAction.Load().(string)
+	return action
+}
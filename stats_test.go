@@ -0,0 +1,58 @@
+package certreloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	r, err := New(certPath, keyPath, time.Hour, WithClock(func() time.Time { return now }), WithOnError(func(error) {}),
+		withRacyWindow(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	check := func(name string, want Stats, action string) {
+		t.Helper()
+		got := r.Stats()
+		want.LastSuccess, want.LastFailure = got.LastSuccess, got.LastFailure
+		if got != want {
+			t.Errorf("%s: got %+v, want %+v", name, got, want)
+		}
+		if got := r.LastAction(); got != action {
+			t.Errorf("%s: got last action %q, want %q", name, got, action)
+		}
+	}
+	check("initial", Stats{Attempts: 1, Installed: 1}, actionReloaded)
+
+	// Untouched files are skipped by their stamps where available, and
+	// rewritten ones are read and found unchanged.
+	untouched := actionSkippedStat
+	if !haveSysStamp {
+		untouched = actionReadUnchanged
+	}
+	r.Reload()
+	check("untouched", Stats{Attempts: 2, Installed: 1, Unchanged: 1}, untouched)
+	replaceTestFile(t, certPath, mustReadTestFile(t, certPath))
+	r.Reload()
+	check("rewritten", Stats{Attempts: 3, Installed: 1, Unchanged: 2}, actionReadUnchanged)
+
+	now = now.Add(time.Minute)
+	writeTestFile(t, keyPath, []byte("garbage"))
+	r.Reload()
+	check("malformed", Stats{Attempts: 4, Installed: 1, Unchanged: 2, Failed: 1}, actionError)
+	if stats := r.Stats(); !stats.LastFailure.Equal(now) || !stats.LastSuccess.Before(now) {
+		t.Errorf("got last success at %v and failure at %v, want failure at %v only", stats.LastSuccess, stats.LastFailure, now)
+	}
+
+	now = now.Add(time.Minute)
+	writeTestPair(t, dir, "rotated")
+	r.Reload()
+	check("rotated", Stats{Attempts: 5, Installed: 2, Unchanged: 2, Failed: 1}, actionReloaded)
+	if stats := r.Stats(); !stats.LastSuccess.Equal(now) || !stats.LastFailure.Before(now) {
+		t.Errorf("got last success at %v and failure at %v, want success at %v", stats.LastSuccess, stats.LastFailure, now)
+	}
+}
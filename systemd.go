@@ -0,0 +1,28 @@
+package certreloader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errNoCredentialsDirectory = errors.New("CREDENTIALS_DIRECTORY is not set")
+
+// NewFromCredentials return a new Reloader for certificate / private key passed
+// as systemd credentials (see LoadCredential= in systemd.exec(5)), i.e. files
+// named certName / keyName in $CREDENTIALS_DIRECTORY. Periodic reloading picks
+// up credentials refreshed by systemd.
+func NewFromCredentials(certName, keyName string, interval time.Duration, opts ...Option) (*Reloader, error) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return nil, errNoCredentialsDirectory
+	}
+	if certName == "" {
+		return nil, errInvalidCertPath
+	}
+	if keyName == "" {
+		return nil, errInvalidKeyPath
+	}
+	return New(filepath.Join(dir, certName), filepath.Join(dir, keyName), interval, opts...)
+}
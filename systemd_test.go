@@ -0,0 +1,47 @@
+package certreloader
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewFromCredentials(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPair(t, dir, "example")
+	for _, tc := range []struct {
+		name              string
+		dir               string
+		certName, keyName string
+		want              error // nil if loading succeeds
+	}{
+		{"loaded", dir, "cert.pem", "key.pem", nil},
+		{"no directory", "", "cert.pem", "key.pem", errNoCredentialsDirectory},
+		{"no certificate name", dir, "", "key.pem", errInvalidCertPath},
+		{"no key name", dir, "cert.pem", "", errInvalidKeyPath},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CREDENTIALS_DIRECTORY", tc.dir)
+			r, err := NewFromCredentials(tc.certName, tc.keyName, time.Hour)
+			if err != tc.want {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+			if err != nil {
+				return
+			}
+			defer r.Stop()
+			if r.CertPath() != filepath.Join(dir, "cert.pem") || r.KeyPath() != filepath.Join(dir, "key.pem") {
+				t.Errorf("got %s / %s, want files in %s", r.CertPath(), r.KeyPath(), dir)
+			}
+			if cn := r.Leaf().Subject.CommonName; cn != "example" {
+				t.Errorf("serving %q", cn)
+			}
+
+			// Credentials refreshed by systemd are reloaded.
+			writeTestPair(t, dir, "refreshed")
+			if res, err := r.Reload(); err != nil || !res.Changed {
+				t.Errorf("got %+v, %v after refresh", res, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package certreloader
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errInvalidEntryName = errors.New("invalid tar entry name")
+
+// NewFromTar return a new Reloader reading certificate / private key from
+// entries named certName / keyName of a tar archive, optionally gzip
+// compressed, as presented by some secret drivers. Entries are extracted in
+// memory, and changes are detected by their contents. Otherwise it works like
+// New.
+func NewFromTar(tarPath, certName, keyName string, interval time.Duration, opts ...Option) (*Reloader, error) {
+	if tarPath == "" {
+		return nil, errInvalidCertPath
+	}
+	if certName == "" || keyName == "" {
+		return nil, errInvalidEntryName
+	}
+	return newReloader(tarSource{tarPath, certName}, tarSource{tarPath, keyName}, interval, opts)
+}
+
+// tarSource reads an entry of a tar archive.
+type tarSource struct {
+	path  string
+	entry string
+}
+
+func (s tarSource) read(ctx context.Context, limit int64) ([]byte, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var rd io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		rd = zr
+	}
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: no entry named %s", s.path, s.entry)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if filepath.Clean(hdr.Name) == filepath.Clean(s.entry) && hdr.Typeflag == tar.TypeReg {
+			return readAll(ctx, tr, limit)
+		}
+	}
+}
+
+func (s tarSource) name() string {
+	return s.path + ":" + s.entry
+}
+
+func (s tarSource) abs() (source, error) {
+	p, err := filepath.Abs(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return tarSource{p, s.entry}, nil
+}
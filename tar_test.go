@@ -0,0 +1,61 @@
+package certreloader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestTar(t *testing.T, path string, compress bool, entries map[string][]byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range entries {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if compress {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		zw.Write(data)
+		zw.Close()
+		data = zbuf.Bytes()
+	}
+	writeTestFile(t, path, data)
+}
+
+func TestNewFromTar(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "secret.tar")
+		certPEM, keyPEM := newTestPair(t, "old.example")
+		writeTestTar(t, path, compress, map[string][]byte{"tls.crt": certPEM, "./tls.key": keyPEM})
+
+		r, err := NewFromTar(path, "tls.crt", "tls.key", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+		checkConsistent(t, r.Get())
+
+		certPEM, keyPEM = newTestPair(t, "new.example")
+		writeTestTar(t, path, compress, map[string][]byte{"tls.crt": certPEM, "tls.key": keyPEM})
+		if res, err := r.Reload(); err != nil || !res.Changed {
+			t.Fatalf("got %+v, %v", res, err)
+		}
+		if cn := r.Leaf().Subject.CommonName; cn != "new.example" {
+			t.Errorf("got certificate for %q, want new.example", cn)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package certreloader
+
+import "os"
+
+// statTrigger returns the stamp of trigger file, or zero stamp if there is none
+// or it does not exist (yet). Stamps rather than contents are compared, so
+// that merely touching the trigger file counts as a change.
+func (r *Reloader) statTrigger() (fileStamp, error) {
+	if r.triggerSrc == nil {
+		return fileStamp{}, nil
+	}
+	fi, err := os.Stat(r.triggerSrc.name())
+	if os.IsNotExist(err) {
+		return fileStamp{}, nil
+	}
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return newFileStamp(fi), nil
+}
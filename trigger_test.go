@@ -0,0 +1,83 @@
+package certreloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTriggerFile(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	triggerPath := filepath.Join(dir, "trigger")
+	writeTestFile(t, triggerPath, nil)
+	r, err := New(certPath, keyPath, time.Hour, WithTriggerFile(triggerPath), WithOnError(func(error) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	touched := time.Now()
+	touch := func() {
+		t.Helper()
+		touched = touched.Add(time.Second)
+		if err := os.Chtimes(triggerPath, touched, touched); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Changed files are not read until the trigger file is touched.
+	writeTestPair(t, dir, "staged")
+	if res, err := r.Reload(); err != nil || !res.skipped {
+		t.Fatalf("got %+v, %v with untouched trigger file", res, err)
+	}
+	touch()
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v after touching trigger file", res, err)
+	}
+	if cn := r.Leaf().Subject.CommonName; cn != "staged" {
+		t.Fatalf("serving %q, want staged", cn)
+	}
+	if res, err := r.Reload(); err != nil || !res.skipped {
+		t.Errorf("got %+v, %v with trigger file untouched since install", res, err)
+	}
+
+	// A failed reload keeps retrying without another touch, until one
+	// succeeds.
+	certPEM := mustReadTestFile(t, certPath)
+	writeTestFile(t, certPath, []byte("garbage"))
+	touch()
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reload(); err == nil {
+			t.Fatalf("reload %d of malformed certificate succeeded", i)
+		}
+	}
+	writeTestFile(t, certPath, certPEM)
+	if res, err := r.Reload(); err != nil || res.skipped {
+		t.Fatalf("got %+v, %v after fixing certificate", res, err)
+	}
+	if res, err := r.Reload(); err != nil || !res.skipped {
+		t.Errorf("got %+v, %v after successful retry", res, err)
+	}
+}
+
+func TestTriggerFileMissing(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	triggerPath := filepath.Join(dir, "trigger")
+	r, err := New(certPath, keyPath, time.Hour, WithTriggerFile(triggerPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// A missing trigger file is unchanged, and its creation is a change.
+	writeTestPair(t, dir, "staged")
+	if res, err := r.Reload(); err != nil || !res.skipped {
+		t.Fatalf("got %+v, %v with missing trigger file", res, err)
+	}
+	writeTestFile(t, triggerPath, nil)
+	if res, err := r.Reload(); err != nil || !res.Changed {
+		t.Fatalf("got %+v, %v after creating trigger file", res, err)
+	}
+}
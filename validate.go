@@ -0,0 +1,121 @@
+package certreloader
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Enforcement tells how a violation of an optional policy is handled.
+type Enforcement int
+
+const (
+	// EnforceNone disables the policy.
+	EnforceNone Enforcement = iota
+	// EnforceWarn reports a violation as a warning, but installs the
+	// certificate anyway.
+	EnforceWarn
+	// EnforceReject rejects a violating certificate, keeping the previously
+	// loaded one.
+	EnforceReject
+)
+
+// apply handles a policy violation err according to e.
+func (e Enforcement) apply(err error, warnings *[]error) error {
+	switch e {
+	case EnforceWarn:
+		*warnings = append(*warnings, err)
+	case EnforceReject:
+		return err
+	}
+	return nil
+}
+
+var (
+	oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+	errNoSCT        = errors.New("certificate does not embed signed certificate timestamps")
+	errChainTooLong = errors.New("certificate chain too long")
+	errIssuer       = errors.New("certificate issuer is not allowed")
+)
+
+// ErrFingerprintMismatch is wrapped by reload errors if the leaf certificate
+// is not one of those pinned by WithPinnedFingerprints.
+var ErrFingerprintMismatch = errors.New("certificate fingerprint is not pinned")
+
+// validate applies configured policies to a newly parsed cert, whose Leaf is
+// populated. A non-nil error rejects cert, keeping the previously loaded one.
+func (r *Reloader) validate(cert *tls.Certificate) (warnings []error, err error) {
+	if len(r.chainSrcs) > 0 {
+		if err = checkChainOrder(cert); err != nil {
+			return
+		}
+	}
+	if r.maxChainLen > 0 && len(cert.Certificate) > r.maxChainLen {
+		err = fmt.Errorf("%w: %d certificates, at most %d allowed", errChainTooLong, len(cert.Certificate), r.maxChainLen)
+		return
+	}
+	if r.keyPolicy != nil {
+		if err = r.keyPolicy.check(cert.Leaf.PublicKey); err != nil {
+			return
+		}
+	}
+	if len(r.pins) > 0 {
+		if fp := r.fingerprint(cert.Leaf); !r.pins[fp] {
+			err = fmt.Errorf("%w: %s=%s", ErrFingerprintMismatch, r.fingerprintLabel(), fp)
+			return
+		}
+	}
+	if len(r.issuers) > 0 {
+		if err = r.checkIssuer(cert); err != nil {
+			return
+		}
+	}
+	if r.parsePolicy != nil {
+		if err = r.parsePolicy.check(cert.Leaf); err != nil {
+			return
+		}
+	}
+	if r.sctPolicy != EnforceNone && !hasSCT(cert) {
+		if err = r.sctPolicy.apply(errNoSCT, &warnings); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// checkIssuer fails unless the issuer of cert is allowed by either its DN, or
+// the public key of the next certificate in chain if that issued the leaf.
+func (r *Reloader) checkIssuer(cert *tls.Certificate) error {
+	dn := cert.Leaf.Issuer.String()
+	if r.issuers[dn] {
+		return nil
+	}
+	if len(cert.Certificate) > 1 {
+		issuer, err := x509.ParseCertificate(cert.Certificate[1])
+		if err == nil && cert.Leaf.CheckSignatureFrom(issuer) == nil {
+			sum := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+			fp := hex.EncodeToString(sum[:])
+			if r.issuers[fp] {
+				return nil
+			}
+			return fmt.Errorf("%w: %q, key sha256=%s", errIssuer, dn, fp)
+		}
+	}
+	return fmt.Errorf("%w: %q", errIssuer, dn)
+}
+
+// hasSCT reports whether the leaf of cert embeds an SCT list extension. The
+// SCTs themselves are not verified.
+func hasSCT(cert *tls.Certificate) bool {
+	for _, ext := range cert.Leaf.Extensions {
+		if ext.Id.Equal(oidSCTList) {
+			return len(ext.Value) > 0
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package certreloader
+
+import "context"
+
+// WaitForReload blocks until a new certificate is installed after it is
+// called, by a reload or Pin, returning nil, or until ctx is done, returning
+// its error. Reloads that find nothing changed or fail do not count.
+func (r *Reloader) WaitForReload(ctx context.Context) error {
+	select {
+	case <-r.installedChan():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WaitForName blocks until the loaded leaf certificate covers name, as by
+// x509.Certificate.VerifyHostname, returning nil, or until ctx is done,
+// returning its error. It returns right away if the certificate already
+// covers name, and otherwise checks each newly installed certificate, e.g.
+// after triggering a rotation to a new set of SANs. Only the primary pair is
+// considered for NewFromBundle and WithAdditionalPair.
+func (r *Reloader) WaitForName(ctx context.Context, name string) error {
+	for {
+		installed := r.installedChan()
+		if leaf := r.Leaf(); leaf != nil && leaf.VerifyHostname(name) == nil {
+			return nil
+		}
+		select {
+		case <-installed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *Reloader) installedChan() chan struct{} {
+	return r.installed.Load().(chan struct{})
+}
+
+// broadcastInstalled wakes up waiters for a newly installed certificate, with
+// r.mu held.
+func (r *Reloader) broadcastInstalled() {
+	close(r.installedChan())
+	r.installed.Store(make(chan struct{}))
+}
@@ -0,0 +1,51 @@
+package certreloader
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWaitForName(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "old.example")
+	r, err := New(certPath, keyPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := r.WaitForName(ctx, "old.example"); err != nil {
+		t.Errorf("got %v for covered name", err)
+	}
+	expired, cancelExpired := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelExpired()
+	if err := r.WaitForReload(expired); err != context.DeadlineExceeded {
+		t.Errorf("got %v without reload, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- r.WaitForName(ctx, "new.example") }()
+	// Neither an unrelated certificate nor a failed reload satisfies it.
+	writeTestPair(t, dir, "other.example")
+	if _, err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(keyPath)
+	r.Reload()
+	select {
+	case err := <-done:
+		t.Fatalf("returned %v before name was covered", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	writeTestPair(t, dir, "new.example")
+	if _, err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
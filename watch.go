@@ -0,0 +1,144 @@
+package certreloader
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchEvent is a set of file system events which trigger a reload when file
+// watching is enabled.
+type WatchEvent uint32
+
+// File system events, see fsnotify for their exact semantics on each platform.
+const (
+	WatchCreate WatchEvent = 1 << iota
+	WatchWrite
+	WatchRemove
+	WatchRename
+	WatchChmod
+
+	// DefaultWatchEvents reliably captures both in-place writes and atomic
+	// replacement by rename, while ignoring permission changes.
+	DefaultWatchEvents = WatchCreate | WatchWrite | WatchRemove | WatchRename
+)
+
+var watchOps = map[WatchEvent]fsnotify.Op{
+	WatchCreate: fsnotify.Create,
+	WatchWrite:  fsnotify.Write,
+	WatchRemove: fsnotify.Remove,
+	WatchRename: fsnotify.Rename,
+	WatchChmod:  fsnotify.Chmod,
+}
+
+// ops converts e to fsnotify.Op.
+func (e WatchEvent) ops() (ops fsnotify.Op) {
+	for event, op := range watchOps {
+		if e&event != 0 {
+			ops |= op
+		}
+	}
+	return
+}
+
+var errWatchUnsupported = errors.New("file watching requires file paths")
+
+// startWatch watches the directories containing the files to be reloaded, or
+// only the trigger or generation file if there is one, so that replacement by
+// rename is noticed as well as in-place writes.
+func (r *Reloader) startWatch() error {
+	names := make(map[string]bool)
+	var patterns []string
+	dirs := make(map[string]bool)
+	r.pathMu.RLock()
+	defer r.pathMu.RUnlock()
+	srcs := r.sources()
+	if r.triggerSrc != nil {
+		srcs = []*source{&r.triggerSrc}
+	} else if r.genSrc != nil {
+		srcs = []*source{&r.genSrc}
+	}
+	for _, src := range srcs {
+		if *src == nil {
+			continue
+		}
+		switch p := (*src).(type) {
+		case pathSource:
+			names[string(p)] = true
+			dirs[filepath.Dir(string(p))] = true
+		case globSource:
+			if hasGlobMeta(filepath.Dir(string(p))) {
+				return errWatchUnsupported
+			}
+			patterns = append(patterns, string(p))
+			dirs[filepath.Dir(string(p))] = true
+		default:
+			return errWatchUnsupported
+		}
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for dir := range dirs {
+		if err = w.Add(dir); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	r.unwatch = make(chan struct{})
+	go r.watch(w, r.unwatch, func(name string) bool {
+		if names[name] {
+			return true
+		}
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}, r.watchEvents.ops())
+	return nil
+}
+
+// watch reloads once no event for any of the watched files arrived for the
+// settle period. Events for certificate and private key are coalesced, so
+// that updating both files results in a single reload after both settled. A
+// reload due within the minimum interval since the previous one is delayed.
+// It returns once r is stopped or unwatch is closed.
+func (r *Reloader) watch(w *fsnotify.Watcher, unwatch <-chan struct{}, watched func(name string) bool, ops fsnotify.Op) {
+	defer w.Close()
+	timer := time.NewTimer(r.watchSettle)
+	timer.Stop()
+	defer timer.Stop()
+	var last time.Time
+	for {
+		select {
+		case <-r.chStop:
+			return
+		case <-unwatch:
+			return
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&ops != 0 && watched(filepath.Clean(ev.Name)) {
+				timer.Reset(r.watchSettle)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			r.reportError(reasonWatchFailed, err)
+		case <-timer.C:
+			if wait := r.watchMinInterval - time.Since(last); wait > 0 {
+				timer.Reset(wait)
+				continue
+			}
+			last = time.Now()
+			r.tick()
+		}
+	}
+}
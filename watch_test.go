@@ -0,0 +1,148 @@
+package certreloader
+
+import (
+	"crypto/tls"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchCoalescesStaggeredWrites(t *testing.T) {
+	const settle = 200 * time.Millisecond
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "old.example")
+
+	var reloads, failures int32
+	r, err := New(certPath, keyPath, time.Hour,
+		WithFileWatch(settle),
+		WithOnReload(func(*tls.Certificate) { atomic.AddInt32(&reloads, 1) }),
+		WithOnError(func(error) { atomic.AddInt32(&failures, 1) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	certPEM, keyPEM := newTestPair(t, "new.example")
+	replaceTestFile(t, certPath, certPEM)
+	time.Sleep(settle / 4)
+	replaceTestFile(t, keyPath, keyPEM)
+	time.Sleep(3 * settle)
+
+	if n := atomic.LoadInt32(&failures); n != 0 {
+		t.Errorf("got %d failed reloads, want 0", n)
+	}
+	if n := atomic.LoadInt32(&reloads); n != 1 {
+		t.Errorf("got %d reloads, want 1", n)
+	}
+	if cn := r.Get().Leaf.Subject.CommonName; cn != "new.example" {
+		t.Errorf("got certificate for %q, want new.example", cn)
+	}
+}
+
+func TestWatchMinInterval(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		minInterval time.Duration
+		minGap      time.Duration // between consecutive watch reloads
+		maxGap      time.Duration
+	}{
+		{"unlimited", 0, 0, 300 * time.Millisecond},
+		{"limited", 300 * time.Millisecond, 300 * time.Millisecond, 10 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			certPath, keyPath := writeTestPair(t, dir, "example")
+			reloaded := make(chan time.Time, 10)
+			r, err := New(certPath, keyPath, time.Hour, WithFileWatch(10*time.Millisecond),
+				WithWatchMinInterval(tc.minInterval),
+				WithOnReload(func(*tls.Certificate) { reloaded <- time.Now() }))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			wait := func() time.Time {
+				t.Helper()
+				select {
+				case at := <-reloaded:
+					return at
+				case <-time.After(10 * time.Second):
+					t.Fatal("change not noticed by watching")
+					return time.Time{}
+				}
+			}
+
+			writeTestPair(t, dir, "first")
+			first := wait()
+			writeTestPair(t, dir, "second")
+			gap := wait().Sub(first)
+			if gap < tc.minGap || gap > tc.maxGap {
+				t.Errorf("reloaded %v after the previous one, want within [%v, %v]", gap, tc.minGap, tc.maxGap)
+			}
+			if cn := r.Leaf().Subject.CommonName; cn != "second" {
+				t.Errorf("serving %q, want the delayed change", cn)
+			}
+		})
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	chmod := func(t *testing.T, path string) {
+		if err := os.Chmod(path, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(t *testing.T, path string) {
+		writeTestFile(t, path, mustReadTestFile(t, path))
+	}
+	rename := func(t *testing.T, path string) {
+		replaceTestFile(t, path, mustReadTestFile(t, path))
+	}
+	for _, tc := range []struct {
+		name   string
+		events WatchEvent
+		change func(t *testing.T, path string)
+		reload bool
+	}{
+		{"default ignores chmod", DefaultWatchEvents, chmod, false},
+		{"chmod", DefaultWatchEvents | WatchChmod, chmod, true},
+		{"default", DefaultWatchEvents, rename, true},
+		{"write", WatchWrite, write, true},
+		{"write ignores rename", WatchWrite, rename, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestReloader(t, WithFileWatch(10*time.Millisecond), WithWatchEvents(tc.events))
+			defer r.Stop()
+			tc.change(t, r.CertPath())
+			reloaded := false
+			for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline) && !reloaded; time.Sleep(time.Millisecond) {
+				reloaded = r.Stats().Attempts > 1
+			}
+			if reloaded != tc.reload {
+				t.Errorf("got reload %v, want %v", reloaded, tc.reload)
+			}
+		})
+	}
+}
+
+func TestInitialDelay(t *testing.T) {
+	reloaded := make(chan struct{}, 1)
+	dir := t.TempDir()
+	certPath, keyPath := writeTestPair(t, dir, "example")
+	r, err := New(certPath, keyPath, time.Hour, WithInitialDelay(10*time.Millisecond),
+		WithOnReload(func(*tls.Certificate) { reloaded <- struct{}{} }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	writeTestPair(t, dir, "example")
+	select {
+	case <-reloaded:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no reload after initial delay")
+	}
+	if next := time.Until(r.NextReload()); next < 59*time.Minute {
+		t.Errorf("next reload in %v, want an interval later", next)
+	}
+}